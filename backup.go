@@ -0,0 +1,28 @@
+package storer
+
+import (
+	"io"
+
+	"github.com/ysmood/storer/pkg/backup"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// Backup stream a consistent snapshot of the whole database to the writer in a single read transaction,
+// all the buckets and the bucket name map are included, so the format is portable across backends.
+// Returns the version of the snapshot, it's zero if the backend doesn't implement kvstore.Versioned.
+func (store *Store) Backup(w io.Writer) (uint64, error) {
+	return backup.Backup(store.db, w)
+}
+
+// BackupSince stream the changes after the version returned by the previous backup,
+// it returns backup.ErrIncremental if the backend doesn't implement kvstore.Versioned.
+func (store *Store) BackupSince(w io.Writer, since uint64) (uint64, error) {
+	return backup.BackupSince(store.db, w, since)
+}
+
+// Restore load the backup created by Store.Backup or Store.BackupSince into the db, the db should be restored
+// before it's used by a Store, because the bucket prefixes are cached by the Store.
+// Returns the version of the backup.
+func Restore(r io.Reader, db kvstore.Store) (uint64, error) {
+	return backup.Restore(r, db)
+}
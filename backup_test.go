@@ -0,0 +1,53 @@
+package storer_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/badger"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	store := storer.New("")
+	events := store.ListWithName("events", &Event{})
+	index := events.Index("seq", func(e *Event) interface{} {
+		return e.Seq
+	})
+	id, _ := events.Add(&Event{1})
+	id2, _ := events.Add(&Event{2})
+
+	full := bytes.NewBuffer(nil)
+	version, err := store.Backup(full)
+	kit.E(err)
+
+	_, _ = events.Add(&Event{3})
+	kit.E(events.Del(id))
+
+	inc := bytes.NewBuffer(nil)
+	_, err = store.BackupSince(inc, version)
+	kit.E(err)
+
+	db := badger.New("")
+	_, err = storer.Restore(full, db)
+	kit.E(err)
+	_, err = storer.Restore(inc, db)
+	kit.E(err)
+
+	restored := storer.NewWithDB("", db).ListWithName("events", &Event{})
+	restoredIndex := restored.Index("seq", func(e *Event) interface{} {
+		return e.Seq
+	})
+
+	var e Event
+	kit.E(restoredIndex.From(3).Find(&e))
+	assert.Equal(t, Event{3}, e)
+	assert.Equal(t, storer.ErrNotFound, restoredIndex.From(1).Find(&e))
+	assert.Equal(t, storer.ErrNotFound, index.From(1).Find(&e))
+
+	kit.E(restored.Get(id2, &e))
+	assert.Equal(t, Event{2}, e)
+	assert.Equal(t, bucketCounts(store), bucketCounts(storer.NewWithDB("", db)))
+}
@@ -0,0 +1,373 @@
+// Command storer inspects the databases created by storer.
+//
+//	storer [flags] <command> [args]
+//
+// The database is opened via one of the -badger dir, the -pg connection string, or the -addr of a
+// server started by badger.Serve.
+// The collection names are the full names printed by the collections command, such as ":main.User:users".
+// The ids are the raw strings of the map keys, use -hex for the hex ids returned by List.Add.
+// The index values for scan are json values, they are encoded the same way as Index.From.
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/nochso/bytesort"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/badger"
+	"github.com/ysmood/storer/pkg/postgres"
+)
+
+const usage = `Usage: storer [flags] <command> [args]
+
+Commands:
+  buckets                                list all the buckets with their prefixes and key counts
+  collections                            list the collections with their counts, indexes and types
+  get <collection> <id>                  print the item as json
+  set <collection> <id> <json | ->       set the item, "-" reads the json from stdin, indexes are not updated
+  del <collection> <id>                  delete the item and its index entries
+  scan <collection> <index> [from] [to]  print the index values and item ids of the index range
+  count [bucket]                         count the keys of the bucket or the whole database
+  check [collection...]                  check the consistency of the indexes, all lists by default
+
+Flags:
+`
+
+var errUsage = errors.New("invalid arguments")
+
+type cli struct {
+	ins *storer.Inspector
+	hex bool
+	in  io.Reader
+	out io.Writer
+}
+
+func main() {
+	flags := flag.NewFlagSet("storer", flag.ExitOnError)
+	dir := flags.String("badger", "", "the dir of the badger database")
+	pg := flags.String("pg", "", "the connection string of the postgres database")
+	addr := flags.String("addr", "", "the address of the badger server")
+	name := flags.String("name", "", "the name of the store")
+	hexID := flags.Bool("hex", false, "the ids are hex encoded")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	var db storer.Database
+	switch {
+	case *dir != "":
+		db = badger.New(*dir)
+	case *pg != "":
+		var err error
+		db, err = openPG(*pg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case *addr != "":
+		db = &client{badger.NewClient(*addr)}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	store := storer.NewWithDB(*name, db)
+	// the inspector should never modify the data by itself
+	store.Janitor(0)
+	defer func() { _ = store.Close() }()
+
+	c := &cli{ins: store.Inspect(), hex: *hexID, in: os.Stdin, out: os.Stdout}
+	err := c.run(flags.Args())
+	if err == errUsage {
+		flags.Usage()
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// errLegacyPG the table of the old versions needs the migration, postgres.New does it
+var errLegacyPG = errors.New(
+	"the postgres table is created by an old version of storer, run the migration via postgres.PG.Init first",
+)
+
+// openPG without postgres.Init, because it creates the table or migrates the legacy one
+func openPG(connStr string) (storer.Database, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	pg := postgres.NewByDB(db)
+	legacy, err := pg.Legacy()
+	if err == nil && legacy {
+		err = errLegacyPG
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return pg, nil
+}
+
+// client the badger client has nothing to close
+type client struct {
+	*badger.Client
+}
+
+func (c *client) Close() error {
+	return nil
+}
+
+func (c *cli) run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	cmd, args := args[0], args[1:]
+	switch {
+	case cmd == "buckets" && len(args) == 0:
+		return c.buckets()
+	case cmd == "collections" && len(args) == 0:
+		return c.collections()
+	case cmd == "get" && len(args) == 2:
+		return c.get(args[0], args[1])
+	case cmd == "set" && len(args) == 3:
+		return c.set(args[0], args[1], args[2])
+	case cmd == "del" && len(args) == 2:
+		return c.del(args[0], args[1])
+	case cmd == "scan" && len(args) >= 2 && len(args) <= 4:
+		return c.scan(args[0], args[1], args[2:])
+	case cmd == "count" && len(args) <= 1:
+		return c.count(args)
+	case cmd == "check":
+		return c.check(args)
+	}
+	return errUsage
+}
+
+func (c *cli) buckets() error {
+	list, err := c.ins.Buckets()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPREFIX\tKEYS")
+	for _, info := range list {
+		fmt.Fprintf(w, "%s\t%x\t%d\n", format(info.Name), info.Prefix, info.Count)
+	}
+	return w.Flush()
+}
+
+func (c *cli) collections() error {
+	list, err := c.ins.Collections()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tITEMS\tINDEXES\tTYPE ID\tVERSIONS")
+	for _, col := range list {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%x\t%d\n",
+			col.Name, col.Count, strings.Join(col.Indexes, ","), col.History[0].ID, len(col.History))
+	}
+	return w.Flush()
+}
+
+func (c *cli) get(collection, id string) error {
+	rawID, err := c.id(id)
+	if err != nil {
+		return err
+	}
+
+	item, err := c.ins.Get(collection, rawID)
+	if err != nil {
+		return err
+	}
+
+	out := map[string]interface{}{
+		"revision": item.Revision,
+		"value":    item.Value,
+	}
+	if item.ExpireAt != 0 {
+		out["expireAt"] = time.Unix(0, item.ExpireAt)
+	}
+	if item.Schema != nil {
+		out["type"] = hex.EncodeToString(item.Schema.ID)
+	}
+
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func (c *cli) set(collection, id, data string) error {
+	rawID, err := c.id(id)
+	if err != nil {
+		return err
+	}
+
+	if data == "-" {
+		b, err := ioutil.ReadAll(c.in)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+
+	value, err := parseJSON(data)
+	if err != nil {
+		return err
+	}
+
+	return c.ins.Set(collection, rawID, value)
+}
+
+func (c *cli) del(collection, id string) error {
+	rawID, err := c.id(id)
+	if err != nil {
+		return err
+	}
+	return c.ins.Delete(collection, rawID)
+}
+
+func (c *cli) scan(collection, index string, args []string) error {
+	bounds := [][]byte{nil, nil}
+	for i, arg := range args {
+		value, err := parseJSON(arg)
+		if err != nil {
+			return err
+		}
+
+		bounds[i], err = bytesort.Encode(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.ins.Scan(collection, index, bounds[0], bounds[1], func(i, id []byte) error {
+		_, err := fmt.Fprintf(c.out, "%s\t%s\n", format(i), c.formatID(id))
+		return err
+	})
+}
+
+func (c *cli) count(args []string) error {
+	name := ""
+	if len(args) == 1 {
+		name = args[0]
+	}
+
+	n, err := c.ins.Count(name)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.out, n)
+	return err
+}
+
+func (c *cli) check(collections []string) error {
+	if len(collections) == 0 {
+		list, err := c.ins.Collections()
+		if err != nil {
+			return err
+		}
+		for _, col := range list {
+			if len(col.Indexes) > 0 {
+				collections = append(collections, col.Name)
+			}
+		}
+	}
+
+	count := 0
+	for _, name := range collections {
+		list, err := c.ins.Check(name)
+		if err != nil {
+			return err
+		}
+
+		for _, i := range list {
+			count++
+			fmt.Fprintf(c.out, "%s\t%s\t%s\t%s\n", i.Collection, i.Index, c.formatID(i.ID), i.Problem)
+		}
+	}
+
+	if count > 0 {
+		return fmt.Errorf("found %d inconsistencies", count)
+	}
+	_, err := fmt.Fprintln(c.out, "ok")
+	return err
+}
+
+func (c *cli) id(id string) ([]byte, error) {
+	if c.hex {
+		return hex.DecodeString(id)
+	}
+	return []byte(id), nil
+}
+
+func (c *cli) formatID(id []byte) string {
+	if c.hex {
+		return hex.EncodeToString(id)
+	}
+	return format(id)
+}
+
+// print the bytes as string if they are printable, otherwise as hex with the "0x" prefix
+func format(b []byte) string {
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) {
+			return "0x" + hex.EncodeToString(b)
+		}
+	}
+	return string(b)
+}
+
+// the integers will be int64, so that they have the same encodings as the int values in go
+func parseJSON(data string) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewBufferString(data))
+	dec.UseNumber()
+
+	var value interface{}
+	err := dec.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return numbers(value), nil
+}
+
+func numbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = numbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = numbers(item)
+		}
+	}
+	return v
+}
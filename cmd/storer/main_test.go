@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/memory"
+)
+
+type Gadget struct {
+	Name  string
+	Price int
+}
+
+const gadgets = ":main.Gadget:gadgets"
+
+func newStore() (*storer.Store, *storer.List) {
+	store := storer.NewWithDB("", memory.New())
+	list := store.ListWithName("gadgets", &Gadget{})
+	_ = list.Index("price", func(g *Gadget) interface{} {
+		return g.Price
+	})
+	return store, list
+}
+
+// run the command, return the output
+func run(store *storer.Store, in string, args ...string) (string, error) {
+	out := bytes.NewBuffer(nil)
+	c := &cli{ins: store.Inspect(), hex: true, in: strings.NewReader(in), out: out}
+	err := c.run(args)
+	return out.String(), err
+}
+
+func TestInspect(t *testing.T) {
+	store, list := newStore()
+	a, _ := list.Add(&Gadget{"a", 10})
+	b, _ := list.Add(&Gadget{"b", 20})
+
+	out, err := run(store, "", "collections")
+	kit.E(err)
+	assert.Regexp(t, gadgets+`\s+2\s+price\s`, out)
+
+	out, err = run(store, "", "buckets")
+	kit.E(err)
+	assert.Contains(t, out, gadgets+":index:price")
+
+	out, err = run(store, "", "get", gadgets, a)
+	kit.E(err)
+	var item struct {
+		Revision int
+		Value    Gadget
+	}
+	kit.E(json.Unmarshal([]byte(out), &item))
+	assert.Equal(t, Gadget{"a", 10}, item.Value)
+	assert.Equal(t, 1, item.Revision)
+
+	_, err = run(store, `{"Name": "c", "Price": 30}`, "set", gadgets, a, "-")
+	kit.E(err)
+	var g Gadget
+	kit.E(list.Get(a, &g))
+	assert.Equal(t, Gadget{"c", 30}, g)
+
+	out, err = run(store, "", "scan", gadgets, "price", "20")
+	kit.E(err)
+	assert.Equal(t, b, strings.Fields(out)[1])
+
+	out, err = run(store, "", "count", gadgets)
+	kit.E(err)
+	assert.Equal(t, "2\n", out)
+
+	_, err = run(store, "", "del", gadgets, b)
+	kit.E(err)
+	out, err = run(store, "", "count", gadgets+":index:price")
+	kit.E(err)
+	assert.Equal(t, "1\n", out)
+
+	_, err = run(store, "", "get", gadgets, b)
+	assert.Equal(t, storer.ErrKeyNotFound, err)
+
+	_, err = run(store, "")
+	assert.Equal(t, errUsage, err)
+	_, err = run(store, "", "get", gadgets)
+	assert.Equal(t, errUsage, err)
+}
+
+func TestCheck(t *testing.T) {
+	store, list := newStore()
+	a, _ := list.Add(&Gadget{"a", 10})
+	_, _ = list.Add(&Gadget{"b", 20})
+
+	out, err := run(store, "", "check")
+	kit.E(err)
+	assert.Equal(t, "ok\n", out)
+
+	// break the reverse index of the item a
+	buckets, err := store.Buckets()
+	kit.E(err)
+	kit.E(store.Update(func(txn kvstore.Txn) error {
+		for _, info := range buckets {
+			if string(info.Name) == gadgets+":rindex:price" {
+				id, _ := hex.DecodeString(a)
+				return txn.Delete(append(info.Prefix, id...))
+			}
+		}
+		return nil
+	}))
+
+	out, err = run(store, "", "check", gadgets)
+	assert.EqualError(t, err, "found 2 inconsistencies")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, gadgets+"\tprice\t"+a+"\tthe item is not indexed", lines[1])
+}
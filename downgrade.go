@@ -0,0 +1,98 @@
+package storer
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/ysmood/storer/pkg/typee"
+)
+
+// Pin the write version of the map to an older type version of the history, the item is an instance of the
+// precedent type, such as the return of Precedent. Reading still returns the latest type, but all the writes
+// will downgrade the items to the pinned version, the records of other versions will be lazily converted to
+// the pinned version when they are read. Use Migrate to convert all the records in bulk, so that a rollback
+// to the old binary that only knows the pinned version is safe.
+// Each type after the pinned version must implement typee.Downgradable.
+func (m *Map) Pin(item interface{}) error {
+	id := typee.GenTypeID(item).ID
+	latest := reflect.New(m.typeID.Type).Interface()
+
+	// check the history before the mapping, so that an unrelated type won't be mapped
+	ids := [][]byte{}
+	for _, v := range typee.History(latest) {
+		ids = append(ids, v.ID)
+	}
+	if !inHistory(ids, id) {
+		return typee.ErrUnknownVersion
+	}
+
+	dictTxn := m.Txn(nil)
+	version, err := dictTxn.typeIDMapper(id)
+	if err != nil {
+		return err
+	}
+
+	// check the version can be reached from the latest type
+	_, err = typee.Downgrade(latest, version, dictTxn.typeIDMapper)
+	if err != nil {
+		return err
+	}
+
+	m.pin = id
+	return nil
+}
+
+// Unpin switch the write version back to the latest type version
+func (m *Map) Unpin() {
+	m.pin = nil
+}
+
+// Pin the write version of the list, check Map.Pin for details
+func (list *List) Pin(item interface{}) error {
+	return list.dict.Pin(item)
+}
+
+// Unpin switch the write version back to the latest type version
+func (list *List) Unpin() {
+	list.dict.Unpin()
+}
+
+// the version that new records will be written with
+func (dictTxn *MapTxn) writeVersion() ([]byte, error) {
+	if dictTxn.dict.pin != nil {
+		return dictTxn.typeIDMapper(dictTxn.dict.pin)
+	}
+	return dictTxn.typeIDMapper(dictTxn.dict.typeID.ID)
+}
+
+// encode the item with the write version
+func (dictTxn *MapTxn) encode(item interface{}) ([]byte, error) {
+	if dictTxn.dict.pin != nil {
+		version, err := dictTxn.writeVersion()
+		if err != nil {
+			return nil, err
+		}
+
+		item, err = typee.Downgrade(item, version, dictTxn.typeIDMapper)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return typee.Encode(item, dictTxn.typeIDMapper)
+}
+
+// stale returns true if the encoded data is not on the write version
+func (dictTxn *MapTxn) stale(data []byte) (bool, error) {
+	latest, err := dictTxn.writeVersion()
+	if err != nil {
+		return false, err
+	}
+
+	version, err := typee.Version(data)
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(version, latest), nil
+}
@@ -0,0 +1,102 @@
+package storer
+
+import (
+	"bytes"
+
+	"github.com/ysmood/storer/pkg/bucket"
+)
+
+// the max number of keys to remove in a single transaction when dropping a bucket
+const dropBatch = 1000
+
+// Buckets list all the named buckets of the database with their prefixes and key counts.
+// The names of the buckets of a store are like "storeName:typeAnchor:collectionName".
+// The keys of all buckets will be iterated, so it can be slow for a large database.
+func (store *Store) Buckets() (list []*bucket.Info, err error) {
+	err = store.View(func(txn Txn) error {
+		list, err = bucket.List(txn)
+		return err
+	})
+	return
+}
+
+// DropBucket remove the bucket and all its data via the full name of the bucket.
+// The data is removed in batches, so it won't exceed the transaction size limit of the backend.
+func (store *Store) DropBucket(name string) error {
+	return bucket.Drop(store.db, []byte(name), dropBatch)
+}
+
+// drop the bucket of the name and all the buckets whose names begin with the name and ":"
+func (store *Store) dropBuckets(name string) error {
+	var names [][]byte
+	err := store.View(func(txn Txn) error {
+		var err error
+		names, err = bucket.Names(txn)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		if string(n) != name && !bytes.HasPrefix(n, []byte(name+":")) {
+			continue
+		}
+		err = bucket.Drop(store.db, n, dropBatch)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drop remove the map and all its data, the map can still be used after the drop as an empty map
+func (m *Map) Drop() error {
+	name := m.store.bucketName(m.typeID.Anchor, m.name)
+
+	err := m.store.DropBucket(name)
+	if err != nil {
+		return err
+	}
+
+	err = m.store.DropBucket(name + ":expiry")
+	if err != nil {
+		return err
+	}
+	m.expiryLock.Lock()
+	m.expiry = nil
+	m.expiryLock.Unlock()
+
+	m.store.expirers.Delete(string(m.bucket.Prefix(nil)))
+
+	m.bucket, err = m.store.newBucket(m.typeID.Anchor, m.name)
+	return err
+}
+
+// Drop remove the list, all its data and all its indexes, even the indexes that are not created in the
+// current process. The list can still be used after the drop as an empty list.
+// The id sequence of the list will be kept, so that the ids won't be reused.
+func (list *List) Drop() error {
+	name := list.dict.store.bucketName(list.dict.typeID.Anchor, list.dict.name)
+
+	for _, kind := range []string{"index", "rindex"} {
+		err := list.dict.store.dropBuckets(name + ":" + kind)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := list.dict.Drop()
+	if err != nil {
+		return err
+	}
+	list.dict.store.expirers.Store(string(list.dict.bucket.Prefix(nil)), expirer(list.expire))
+
+	for _, index := range list.indexes {
+		err = index.open()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
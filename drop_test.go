@@ -0,0 +1,136 @@
+package storer_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/badger"
+)
+
+func bucketCounts(store *storer.Store) map[string]int {
+	list, err := store.Buckets()
+	kit.E(err)
+
+	counts := map[string]int{}
+	for _, info := range list {
+		counts[string(info.Name)] = info.Count
+	}
+	return counts
+}
+
+func TestBuckets(t *testing.T) {
+	store := storer.New("")
+	users := store.ListWithName("users", &Event{})
+	_ = users.Index("seq", func(e *Event) interface{} {
+		return e.Seq
+	})
+
+	_, _ = users.Add(&Event{1})
+	_, _ = users.Add(&Event{2})
+
+	counts := bucketCounts(store)
+	assert.Equal(t, 2, counts[":storer_test.Event:users"])
+	assert.Equal(t, 2, counts[":storer_test.Event:users:index:seq"])
+	assert.Equal(t, 2, counts[":storer_test.Event:users:rindex:seq"])
+
+	kit.E(store.DropBucket(":storer_test.Event:users:rindex:seq"))
+	_, has := bucketCounts(store)[":storer_test.Event:users:rindex:seq"]
+	assert.False(t, has)
+}
+
+func TestListDrop(t *testing.T) {
+	store := storer.New("")
+	users := store.ListWithName("users", &Event{})
+	index := users.Index("seq", func(e *Event) interface{} {
+		return e.Seq
+	})
+
+	// an index that is not created by the users list
+	other := store.ListWithName("users", &Event{})
+	_ = other.Index("other", func(e *Event) interface{} {
+		return e.Seq
+	})
+	_, _ = other.Add(&Event{1})
+
+	for i := 0; i < 2000; i++ {
+		_, _ = users.Add(&Event{i})
+	}
+
+	kit.E(users.Drop())
+
+	counts := bucketCounts(store)
+	assert.Equal(t, 0, counts[":storer_test.Event:users"])
+	assert.Equal(t, 0, counts[":storer_test.Event:users:index:seq"])
+	assert.Equal(t, 0, counts[":storer_test.Event:users:rindex:seq"])
+	_, has := counts[":storer_test.Event:users:index:other"]
+	assert.False(t, has)
+
+	// the list can still be used
+	var e Event
+	assert.Equal(t, storer.ErrNotFound, index.From(1).Find(&e))
+	_, _ = users.Add(&Event{3})
+	kit.E(index.From(3).Find(&e))
+	assert.Equal(t, 3, e.Seq)
+}
+
+func TestListDropSimilarName(t *testing.T) {
+	store := storer.New("")
+	user := store.ListWithName("user", &Event{})
+	users := store.ListWithName("users", &Event{})
+	for _, list := range []*storer.List{user, users} {
+		_ = list.Index("seq", func(e *Event) interface{} {
+			return e.Seq
+		})
+		_, _ = list.Add(&Event{1})
+	}
+
+	kit.E(user.Drop())
+
+	counts := bucketCounts(store)
+	assert.Equal(t, 0, counts[":storer_test.Event:user:index:seq"])
+	assert.Equal(t, 1, counts[":storer_test.Event:users"])
+	assert.Equal(t, 1, counts[":storer_test.Event:users:index:seq"])
+	assert.Equal(t, 1, counts[":storer_test.Event:users:rindex:seq"])
+}
+
+func TestIndexDropErr(t *testing.T) {
+	db := &TestStore{badger: badger.New("")}
+	store := storer.NewWithDB("", db)
+	users := store.ListWithName("users", &Event{})
+	index := users.Index("seq", func(e *Event) interface{} {
+		return e.Seq
+	})
+	_, _ = users.Add(&Event{1})
+
+	testErr := errors.New("err")
+	db.deleteQueue = []interface{}{testErr}
+	assert.Equal(t, testErr, index.Drop())
+
+	// the index is still maintained
+	_, _ = users.Add(&Event{2})
+	var e Event
+	kit.E(index.From(2).Find(&e))
+	assert.Equal(t, 2, e.Seq)
+
+	kit.E(index.Drop())
+	_, has := bucketCounts(store)[":storer_test.Event:users:index:seq"]
+	assert.False(t, has)
+}
+
+func TestMapDrop(t *testing.T) {
+	store := storer.New("")
+	dict := store.MapWithName("dict", &Event{})
+	kit.E(dict.Set("a", &Event{1}))
+
+	kit.E(dict.Drop())
+
+	var e Event
+	assert.Equal(t, storer.ErrKeyNotFound, dict.Get("a", &e))
+	kit.E(dict.Set("a", &Event{2}))
+	kit.E(dict.Get("a", &e))
+	assert.Equal(t, 2, e.Seq)
+	assert.Equal(t, 1, bucketCounts(store)[":storer_test.Event:dict"])
+}
@@ -0,0 +1,445 @@
+package storer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/ysmood/storer/pkg/typee"
+)
+
+// Format the file format to export and import collections
+type Format int
+
+const (
+	// JSONLines each line is a json object like {"id":"...","item":{...}}
+	JSONLines Format = iota
+	// CSV the first column is the id, the fields of the item are flattened as the rest columns,
+	// the names of the nested fields are joined by ".", the values that can't be flattened are json encoded
+	CSV
+)
+
+// ErrFormat ...
+var ErrFormat = errors.New("[storer] unknown format")
+
+// the max number of items to import in a single transaction
+const importBatch = 1000
+
+type getItem func(txn Txn, id []byte, item interface{}) error
+type putItem func(txn Txn, id []byte, item interface{}) error
+
+// Export stream all the items of the map to the writer, the id is the same as the one used by Map.Get
+func (m *Map) Export(w io.Writer, format Format) error {
+	return m.export(w, format, func(id []byte) string {
+		return string(id)
+	}, func(txn Txn, id []byte, item interface{}) error {
+		_, err := m.Txn(txn).get(id, nil, item)
+		return err
+	})
+}
+
+// Import stream the items from the reader exported by Map.Export, the items with the same ids
+// will be overwritten. Returns the number of imported items.
+func (m *Map) Import(r io.Reader, format Format) (int, error) {
+	return m.importItems(r, format, func(id string) ([]byte, error) {
+		return []byte(id), nil
+	}, func(txn Txn, id []byte, item interface{}) error {
+		return m.Txn(txn).SetByBytes(id, item)
+	})
+}
+
+// Export stream all the items of the list to the writer, the id is the same as the one used by List.Get
+func (list *List) Export(w io.Writer, format Format) error {
+	return list.dict.export(w, format, hex.EncodeToString, func(txn Txn, id []byte, item interface{}) error {
+		_, err := list.Txn(txn).get(id, nil, item)
+		return err
+	})
+}
+
+// Import stream the items from the reader exported by List.Export, the ids will be preserved, the items with
+// the same ids will be overwritten, and the indexes will be rebuilt. Returns the number of imported items.
+func (list *List) Import(r io.Reader, format Format) (int, error) {
+	return list.dict.importItems(r, format, hex.DecodeString, func(txn Txn, id []byte, item interface{}) error {
+		listTxn := list.Txn(txn)
+
+		prev, err := listTxn.dictTxn.prev(id)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			return listTxn.add(id, item, 0)
+		}
+		return listTxn.set(id, item, 0, prev)
+	})
+}
+
+// Export write the value to the writer, the id will be empty
+func (v *Value) Export(w io.Writer, format Format) error {
+	return v.dict.Export(w, format)
+}
+
+// Import read the value from the reader exported by Value.Export
+func (v *Value) Import(r io.Reader, format Format) (int, error) {
+	return v.dict.importItems(r, format, func(string) ([]byte, error) {
+		return nil, nil
+	}, func(txn Txn, _ []byte, item interface{}) error {
+		return v.dict.Txn(txn).SetByBytes(nil, item)
+	})
+}
+
+// export the items in a single read transaction, the items will be decoded via typee, so the migrations apply
+func (m *Map) export(w io.Writer, format Format, encodeID func([]byte) string, get getItem) error {
+	enc, err := newItemEncoder(w, format, m.typeID.Type)
+	if err != nil {
+		return err
+	}
+
+	err = m.store.View(func(txn Txn) error {
+		return m.Txn(txn).Each(func(id []byte) error {
+			item := reflect.New(m.typeID.Type).Interface()
+			err := get(txn, id, item)
+			if err == ErrKeyNotFound {
+				return nil
+			} else if err != nil && err != typee.ErrMigrated {
+				return err
+			}
+
+			return enc.write(encodeID(id), item)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return enc.flush()
+}
+
+// import the items in batches, each batch is a transaction
+func (m *Map) importItems(r io.Reader, format Format, decodeID func(string) ([]byte, error), put putItem) (int, error) {
+	dec, err := newItemDecoder(r, format, m.typeID.Type)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for done := false; !done; {
+		n := 0
+		err := m.store.Update(func(txn Txn) error {
+			n = 0
+			for ; n < importBatch; n++ {
+				id, item, err := dec.read()
+				if err == io.EOF {
+					done = true
+					return nil
+				} else if err != nil {
+					return err
+				}
+
+				b, err := decodeID(id)
+				if err != nil {
+					return err
+				}
+
+				err = put(txn, b, item)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+type itemEncoder interface {
+	write(id string, item interface{}) error
+	flush() error
+}
+
+type itemDecoder interface {
+	// read returns io.EOF when there's no more item
+	read() (string, interface{}, error)
+}
+
+func newItemEncoder(w io.Writer, format Format, t reflect.Type) (itemEncoder, error) {
+	switch format {
+	case JSONLines:
+		buf := bufio.NewWriter(w)
+		return &jsonLinesEncoder{buf: buf, enc: json.NewEncoder(buf)}, nil
+	case CSV:
+		enc := &csvEncoder{w: csv.NewWriter(w), columns: csvColumns(t)}
+		return enc, enc.header()
+	}
+	return nil, ErrFormat
+}
+
+func newItemDecoder(r io.Reader, format Format, t reflect.Type) (itemDecoder, error) {
+	switch format {
+	case JSONLines:
+		return &jsonLinesDecoder{dec: json.NewDecoder(r), t: t}, nil
+	case CSV:
+		dec := &csvDecoder{r: csv.NewReader(r), t: t}
+		return dec, dec.header()
+	}
+	return nil, ErrFormat
+}
+
+type jsonLine struct {
+	ID   string          `json:"id,omitempty"`
+	Item json.RawMessage `json:"item"`
+}
+
+type jsonLinesEncoder struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *jsonLinesEncoder) write(id string, item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return e.enc.Encode(&jsonLine{ID: id, Item: data})
+}
+
+func (e *jsonLinesEncoder) flush() error {
+	return e.buf.Flush()
+}
+
+type jsonLinesDecoder struct {
+	dec *json.Decoder
+	t   reflect.Type
+}
+
+func (d *jsonLinesDecoder) read() (string, interface{}, error) {
+	var line jsonLine
+	err := d.dec.Decode(&line)
+	if err != nil {
+		return "", nil, err
+	}
+
+	item := reflect.New(d.t).Interface()
+	return line.ID, item, json.Unmarshal(line.Item, item)
+}
+
+// csvColumn a flattened field, the path is the json names of the nested fields,
+// the path of a non-struct item is empty
+type csvColumn struct {
+	name string
+	path []string
+	str  bool
+}
+
+var typeJSONMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var typeTextMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// get the flattened columns of the type like how encoding/json encodes the fields
+func csvColumns(t reflect.Type) []*csvColumn {
+	return flattenColumns(t, nil, map[reflect.Type]bool{})
+}
+
+func flattenColumns(t reflect.Type, path []string, visiting map[reflect.Type]bool) []*csvColumn {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || visiting[t] || isJSONLeaf(t) {
+		name := strings.Join(path, ".")
+		if name == "" {
+			name = "value"
+		}
+		return []*csvColumn{{name: name, path: path, str: t.Kind() == reflect.String}}
+	}
+
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	columns := []*csvColumn{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// the fields of embedded structs are promoted
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			columns = append(columns, flattenColumns(ft, path, visiting)...)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		columns = append(columns, flattenColumns(f.Type, append(path[:len(path):len(path)], name), visiting)...)
+	}
+	return columns
+}
+
+func isJSONLeaf(t reflect.Type) bool {
+	for _, i := range []reflect.Type{typeJSONMarshaler, typeTextMarshaler} {
+		if t.Implements(i) || reflect.PtrTo(t).Implements(i) {
+			return true
+		}
+	}
+	return false
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []*csvColumn
+}
+
+func (e *csvEncoder) header() error {
+	row := []string{"id"}
+	for _, col := range e.columns {
+		row = append(row, col.name)
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvEncoder) write(id string, item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj interface{}
+	err = dec.Decode(&obj)
+	if err != nil {
+		return err
+	}
+
+	row := []string{id}
+	for _, col := range e.columns {
+		cell, err := col.cell(obj)
+		if err != nil {
+			return err
+		}
+		row = append(row, cell)
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// get the cell from the json object, strings won't be quoted, empty means the field is null or missing
+func (col *csvColumn) cell(obj interface{}) (string, error) {
+	for _, key := range col.path {
+		dict, ok := obj.(map[string]interface{})
+		if !ok {
+			return "", nil
+		}
+		obj = dict[key]
+	}
+
+	switch v := obj.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+
+	data, err := json.Marshal(obj)
+	return string(data), err
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	t       reflect.Type
+	columns []*csvColumn
+}
+
+// the columns that don't belong to the type will be ignored
+func (d *csvDecoder) header() error {
+	row, err := d.r.Read()
+	if err != nil {
+		return err
+	}
+
+	dict := map[string]*csvColumn{}
+	for _, col := range csvColumns(d.t) {
+		dict[col.name] = col
+	}
+
+	d.columns = []*csvColumn{}
+	for _, name := range row[1:] {
+		d.columns = append(d.columns, dict[name])
+	}
+	return nil
+}
+
+func (d *csvDecoder) read() (string, interface{}, error) {
+	row, err := d.r.Read()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var obj interface{} = map[string]interface{}{}
+	for i, col := range d.columns {
+		cell := row[i+1]
+		if col == nil || cell == "" {
+			continue
+		}
+		obj = col.set(obj, cell)
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", nil, err
+	}
+
+	item := reflect.New(d.t).Interface()
+	return row[0], item, json.Unmarshal(data, item)
+}
+
+// set the cell to the json object, returns the new object
+func (col *csvColumn) set(obj interface{}, cell string) interface{} {
+	var value interface{} = cell
+	if !col.str && json.Valid([]byte(cell)) {
+		value = json.RawMessage(cell)
+	}
+
+	if len(col.path) == 0 {
+		return value
+	}
+
+	dict := obj.(map[string]interface{})
+	for _, key := range col.path[:len(col.path)-1] {
+		next, ok := dict[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			dict[key] = next
+		}
+		dict = next
+	}
+	dict[col.path[len(col.path)-1]] = value
+	return obj
+}
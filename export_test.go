@@ -0,0 +1,107 @@
+package storer_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+)
+
+type Address struct {
+	City string `json:"city"`
+	Zip  int
+}
+
+type Employee struct {
+	Name    string
+	Age     int
+	Tags    []string
+	Address *Address
+}
+
+func TestListExportImport(t *testing.T) {
+	for _, format := range []storer.Format{storer.JSONLines, storer.CSV} {
+		store := storer.New("")
+		people := store.List(&Employee{})
+		_, _ = people.Add(&Employee{"jack", 10, []string{"a", "b"}, &Address{"x, y", 1}})
+		id, _ := people.Add(&Employee{Name: "tom", Age: 20})
+
+		buf := bytes.NewBuffer(nil)
+		kit.E(people.Export(buf, format))
+
+		target := storer.New("").List(&Employee{})
+		index := target.Index("age", func(p *Employee) interface{} {
+			return p.Age
+		})
+		n, err := target.Import(buf, format)
+		kit.E(err)
+		assert.Equal(t, 2, n)
+
+		var p Employee
+		kit.E(target.Get(id, &p))
+		assert.Equal(t, Employee{Name: "tom", Age: 20}, p)
+
+		kit.E(index.From(10).Find(&p))
+		assert.Equal(t, Employee{"jack", 10, []string{"a", "b"}, &Address{"x, y", 1}}, p)
+	}
+}
+
+func TestListExportCSV(t *testing.T) {
+	store := storer.New("")
+	people := store.ListWithName("people", &Employee{})
+	id, _ := people.Add(&Employee{"jack", 10, []string{"a"}, &Address{"x", 1}})
+
+	buf := bytes.NewBuffer(nil)
+	kit.E(people.Export(buf, storer.CSV))
+
+	assert.Equal(t, "id,Name,Age,Tags,Address.city,Address.Zip\n"+id+`,jack,10,"[""a""]",x,1`+"\n", buf.String())
+
+	// unknown columns are ignored, missing columns are zero values
+	n, err := people.Import(strings.NewReader("id,Age,Other\n"+id+",20,1\n"), storer.CSV)
+	kit.E(err)
+	assert.Equal(t, 1, n)
+
+	var p Employee
+	kit.E(people.Get(id, &p))
+	assert.Equal(t, Employee{Age: 20}, p)
+}
+
+func TestMapAndValueExportImport(t *testing.T) {
+	store := storer.New("")
+	dict := store.MapWithName("dict", &Employee{})
+	for _, name := range []string{"a", "b", "c"} {
+		kit.E(dict.Set(name, &Employee{Name: name}))
+	}
+
+	buf := bytes.NewBuffer(nil)
+	kit.E(dict.Export(buf, storer.JSONLines))
+	assert.Equal(t, 3, strings.Count(buf.String(), "\n"))
+
+	target := storer.New("").MapWithName("dict", &Employee{})
+	n, err := target.Import(buf, storer.JSONLines)
+	kit.E(err)
+	assert.Equal(t, 3, n)
+
+	var p Employee
+	kit.E(target.Get("b", &p))
+	assert.Equal(t, "b", p.Name)
+
+	count := 10
+	value := store.Value("count", &count)
+	buf.Reset()
+	kit.E(value.Export(buf, storer.CSV))
+	assert.Equal(t, "id,value\n,10\n", buf.String())
+
+	count = 0
+	target2 := storer.New("").Value("count", &count)
+	_, err = target2.Import(buf, storer.CSV)
+	kit.E(err)
+	kit.E(target2.Get(&count))
+	assert.Equal(t, 10, count)
+
+	_, err = target2.Import(buf, storer.Format(10))
+	assert.Equal(t, storer.ErrFormat, err)
+}
@@ -3,13 +3,18 @@ module github.com/ysmood/storer
 go 1.14
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/dgraph-io/badger/v2 v2.0.2
+	github.com/gomodule/redigo v1.8.2
 	github.com/kylelemons/godebug v1.1.0 // indirect
 	github.com/lib/pq v1.3.0
 	github.com/nochso/bytesort v0.0.0-20170918190500-3c6f8391bc94
 	github.com/stretchr/testify v1.5.1
+	github.com/syndtr/goleveldb v1.0.0
 	github.com/vmihailenco/msgpack v4.0.4+incompatible
 	github.com/ysmood/byframe v1.1.2
 	github.com/ysmood/kit v0.22.0
+	go.etcd.io/bbolt v1.3.4
 	google.golang.org/appengine v1.6.5 // indirect
+	modernc.org/sqlite v1.20.3
 )
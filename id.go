@@ -0,0 +1,62 @@
+package storer
+
+import (
+	"encoding/binary"
+
+	"github.com/ysmood/storer/pkg/idgen"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/typee"
+)
+
+// IDGen generates the id for a new item of a list.
+// Because ListTxn.Each iterates items by the byte-wise order of their ids,
+// a time-sortable IDGen makes Each return items in insertion order.
+type IDGen func(txn kvstore.Txn, item interface{}) ([]byte, error)
+
+// IDGenRandom the default IDGen, it uses typee.GenID so the typee.Unique of the item is respected
+func IDGenRandom(_ kvstore.Txn, item interface{}) ([]byte, error) {
+	return typee.GenID(item), nil
+}
+
+// IDGenULID generates 16 bytes ULIDs
+func IDGenULID(kvstore.Txn, interface{}) ([]byte, error) {
+	return idgen.ULID(), nil
+}
+
+// IDGenKSUID generates 20 bytes KSUID-like ids
+func IDGenKSUID(kvstore.Txn, interface{}) ([]byte, error) {
+	return idgen.KSUID(), nil
+}
+
+// IDGenUUIDv7 generates 16 bytes UUIDv7s
+func IDGenUUIDv7(kvstore.Txn, interface{}) ([]byte, error) {
+	return idgen.UUIDv7(), nil
+}
+
+// SetIDGen set the id generator of the list, returns the list itself
+func (list *List) SetIDGen(gen IDGen) *List {
+	list.genID = gen
+	return list
+}
+
+// IDGenSequence generates 8 bytes big-endian ids from a counter persisted in the list,
+// the first id is 1. Because the counter is updated in the same transaction of the item,
+// concurrent adds to the same list may conflict.
+func (list *List) IDGenSequence() IDGen {
+	seq := list.dict.store.bucket(list.dict.typeID.Anchor, list.dict.name, "sequence")
+
+	return func(txn kvstore.Txn, _ interface{}) ([]byte, error) {
+		key := seq.Prefix(nil)
+
+		var n uint64
+		b, err := txn.Get(key)
+		if err == nil {
+			n = binary.BigEndian.Uint64(b)
+		} else if err != ErrKeyNotFound {
+			return nil, err
+		}
+
+		id := idgen.Sequence(n + 1)
+		return id, txn.Set(key, id)
+	}
+}
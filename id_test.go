@@ -0,0 +1,104 @@
+package storer_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/badger"
+	"github.com/ysmood/storer/pkg/idgen"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+type Event struct {
+	Seq int
+}
+
+func listEvents(list *storer.List) []Event {
+	res := []Event{}
+	kit.E(list.View(func(txn *storer.ListTxn) error {
+		return txn.Each(func(id []byte) error {
+			var e Event
+			kit.E(txn.GetByBytes(id, &e))
+			res = append(res, e)
+			return nil
+		})
+	}))
+	return res
+}
+
+func TestIDGen(t *testing.T) {
+	gens := []storer.IDGen{storer.IDGenULID, storer.IDGenKSUID, storer.IDGenUUIDv7}
+
+	for _, gen := range gens {
+		events := store.ListWithName(kit.RandString(10), &Event{}).SetIDGen(gen)
+
+		expected := []Event{}
+		for i := 0; i < 100; i++ {
+			_, err := events.Add(&Event{i})
+			kit.E(err)
+			expected = append(expected, Event{i})
+		}
+
+		assert.Equal(t, expected, listEvents(events))
+	}
+}
+
+func TestIDGenSequence(t *testing.T) {
+	events := store.ListWithName(kit.RandString(10), &Event{})
+	events.SetIDGen(events.IDGenSequence())
+
+	id, err := events.Add(&Event{0})
+	kit.E(err)
+	assert.Equal(t, "0000000000000001", id)
+
+	id, err = events.Add(&Event{1})
+	kit.E(err)
+	assert.Equal(t, "0000000000000002", id)
+
+	assert.Equal(t, []Event{{0}, {1}}, listEvents(events))
+
+	testErr := errors.New("err")
+	db := &TestStore{badger: badger.New("")}
+	events = storer.NewWithDB("", db).ListWithName(kit.RandString(10), &Event{})
+	events.SetIDGen(events.IDGenSequence())
+	db.getQueue = []interface{}{
+		[]interface{}{[]byte{}, testErr},
+	}
+	_, err = events.Add(&Event{})
+	assert.Equal(t, testErr, err)
+}
+
+func TestEachFrom(t *testing.T) {
+	events := store.ListWithName(kit.RandString(10), &Event{}).SetIDGen(storer.IDGenULID)
+
+	_, _ = events.Add(&Event{0})
+	time.Sleep(2 * time.Millisecond)
+	from := time.Now()
+	_, _ = events.Add(&Event{1})
+	_, _ = events.Add(&Event{2})
+	time.Sleep(2 * time.Millisecond)
+	to := time.Now()
+	_, _ = events.Add(&Event{3})
+
+	res := []Event{}
+	kit.E(events.View(func(txn *storer.ListTxn) error {
+		end := idgen.ULIDPrefix(to)
+
+		return txn.EachFrom(idgen.ULIDPrefix(from), func(id []byte) error {
+			if bytes.Compare(id, end) >= 0 {
+				return kvstore.ErrStop
+			}
+			var e Event
+			kit.E(txn.GetByBytes(id, &e))
+			res = append(res, e)
+			return nil
+		})
+	}))
+
+	assert.Equal(t, []Event{{1}, {2}}, res)
+}
@@ -43,6 +43,20 @@ type Index struct {
 	genIndex GenIndexBytes
 }
 
+// open the buckets of the index
+func (index *Index) open() error {
+	dict := index.list.dict
+
+	var err error
+	index.bucket, err = dict.store.newBucket(dict.typeID.Anchor, dict.name, "index", index.name)
+	if err != nil {
+		return err
+	}
+
+	index.rbucket, err = dict.store.newBucket(dict.typeID.Anchor, dict.name, "rindex", index.name)
+	return err
+}
+
 // Generate an unique id, format "bucket indexLength index itemID"
 // Why use key only for indexing is because we need to make sure
 // different items can has the same index.
@@ -65,22 +79,25 @@ func (index *Index) extractItemID(key []byte) []byte {
 	return key[l+hLen+indexLen:]
 }
 
-func (index *Index) add(txn kvstore.Txn, itemID []byte, item interface{}) error {
+func (index *Index) add(txn kvstore.Txn, itemID []byte, item interface{}, expireAt int64) error {
 	i, err := index.genIndex(&GenCtx{Item: item, Txn: txn, Action: IndexCreate})
 	if err != nil {
 		return err
 	}
 	key := index.id(i, itemID)
 
-	err = txn.Set(index.rbucket.Prefix(itemID), i)
+	store := index.list.dict.store
+
+	err = store.set(txn, index.rbucket.Prefix(itemID), i, expireAt)
 	if err != nil {
 		return err
 	}
 
-	return txn.Set(key, nil)
+	return store.set(txn, key, nil, expireAt)
 }
 
-func (index *Index) update(txn kvstore.Txn, itemID []byte, item interface{}) error {
+// when refresh is true the entries will be rewritten even the index doesn't change
+func (index *Index) update(txn kvstore.Txn, itemID []byte, item interface{}, expireAt int64, refresh bool) error {
 	rid := index.rbucket.Prefix(itemID)
 	old, err := txn.Get(rid)
 	if err != nil {
@@ -92,16 +109,26 @@ func (index *Index) update(txn kvstore.Txn, itemID []byte, item interface{}) err
 		return err
 	}
 
-	if bytes.Equal(old, i) {
+	changed := !bytes.Equal(old, i)
+	if !changed && !refresh {
 		return nil
 	}
 
-	err = txn.Set(rid, i)
+	if changed {
+		err = txn.Delete(index.id(old, itemID))
+		if err != nil {
+			return err
+		}
+	}
+
+	store := index.list.dict.store
+
+	err = store.set(txn, rid, i, expireAt)
 	if err != nil {
 		return err
 	}
 
-	return txn.Set(index.id(i, itemID), nil)
+	return store.set(txn, index.id(i, itemID), nil, expireAt)
 }
 
 func (index *Index) del(txn kvstore.Txn, itemID []byte) error {
@@ -149,12 +176,18 @@ func (txnCtx *IndexTxn) Reindex() error {
 		}
 		itemID := key[l:]
 
+		listTxn := txnCtx.index.list.Txn(txnCtx.txn)
+
 		item := reflect.New(txnCtx.index.list.dict.typeID.Type).Interface()
-		err := txnCtx.index.list.Txn(txnCtx.txn).GetByBytes(itemID, item)
-		if err != nil {
+		r, err := listTxn.get(itemID, nil, item)
+		if err == ErrKeyNotFound {
+			// the item is expired
+			return nil
+		} else if err != nil {
 			return err
 		}
-		return txnCtx.index.update(txnCtx.txn, itemID, item)
+
+		return txnCtx.index.update(txnCtx.txn, itemID, item, r.expireAt, false)
 	})
 }
 
@@ -188,10 +221,19 @@ func (ctx *FromCtx) Each(fn Iteratee) error {
 			return ErrStop
 		}
 
-		return fn(&IterCtx{
+		iterCtx := &IterCtx{
 			forCtx: ctx,
 			key:    key,
-		})
+		}
+
+		// skip the expired items
+		alive, raw, err := ctx.txnCtx.index.list.dict.Txn(ctx.txnCtx.txn).alive(iterCtx.IDBytes())
+		if err != nil || !alive {
+			return err
+		}
+		iterCtx.raw = raw
+
+		return fn(iterCtx)
 	})
 }
 
@@ -199,6 +241,9 @@ func (ctx *FromCtx) Each(fn Iteratee) error {
 type IterCtx struct {
 	forCtx *FromCtx
 	key    []byte
+
+	// raw the cached record of the item
+	raw []byte
 }
 
 // ErrStop ...
@@ -129,9 +129,10 @@ func (ctx *IterCtx) Compare(v interface{}) int {
 
 // Item ...
 func (ctx *IterCtx) Item(item interface{}) error {
-	return ctx.forCtx.txnCtx.index.list.Txn(
+	_, err := ctx.forCtx.txnCtx.index.list.Txn(
 		ctx.forCtx.txnCtx.txn,
-	).GetByBytes(ctx.IDBytes(), item)
+	).get(ctx.IDBytes(), ctx.raw, item)
+	return err
 }
 
 // Reindex ...
@@ -0,0 +1,490 @@
+package storer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vmihailenco/msgpack"
+	"github.com/ysmood/byframe"
+	"github.com/ysmood/storer/pkg/bucket"
+)
+
+// ErrUnknownCollection ...
+var ErrUnknownCollection = errors.New("[storer] unknown collection")
+
+// Inspector access the collections without their go types, the items are decoded as generic values,
+// such as map[string]interface{}, via the field names stored by the msgpack codec.
+// The names of the collections are the full names like "storeName:typeAnchor:collectionName".
+type Inspector struct {
+	store *Store
+}
+
+// Inspect ...
+func (store *Store) Inspect() *Inspector {
+	return &Inspector{store: store}
+}
+
+// Buckets same as Store.Buckets
+func (ins *Inspector) Buckets() ([]*bucket.Info, error) {
+	return ins.store.Buckets()
+}
+
+// CollectionInfo ...
+type CollectionInfo struct {
+	Collection
+	// Count the number of records, including the expired ones that are not swept yet
+	Count int
+	// Indexes the names of the indexes, a collection with indexes must be a list
+	Indexes []string
+}
+
+// Collections list the registered collections with their record counts and indexes
+func (ins *Inspector) Collections() (list []*CollectionInfo, err error) {
+	collections, err := ins.store.Collections()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ins.store.View(func(txn Txn) error {
+		names, err := bucket.Names(txn)
+		if err != nil {
+			return err
+		}
+
+		for _, col := range collections {
+			info := &CollectionInfo{Collection: *col, Indexes: []string{}}
+			list = append(list, info)
+
+			b, err := bucket.Lookup(txn, []byte(col.Name))
+			if err == ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			info.Count, err = b.Count(txn)
+			if err != nil {
+				return err
+			}
+
+			prefix := col.Name + ":index:"
+			for _, name := range names {
+				if strings.HasPrefix(string(name), prefix) {
+					info.Indexes = append(info.Indexes, string(name[len(prefix):]))
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// RawItem an item decoded without its go type
+type RawItem struct {
+	ID []byte
+	// Schema the type version of the item, nil if it's not in the history of the collection
+	Schema   *Schema
+	ExpireAt int64
+	Revision uint64
+	Value    interface{}
+}
+
+// Get the item of the collection by the raw id
+func (ins *Inspector) Get(collection string, id []byte) (item *RawItem, err error) {
+	err = ins.store.View(func(txn Txn) error {
+		b, err := lookupCollection(txn, collection)
+		if err != nil {
+			return err
+		}
+
+		raw, err := b.Get(txn, id)
+		if err != nil {
+			return err
+		}
+
+		r, err := decodeRecord(raw)
+		if err != nil {
+			return err
+		}
+
+		var version, data []byte
+		err = byframe.DecodeTuple(r.data, &version, &data)
+		if err != nil {
+			return err
+		}
+
+		var value interface{}
+		err = msgpack.Unmarshal(data, &value)
+		if err != nil {
+			return err
+		}
+
+		item = &RawItem{ID: id, ExpireAt: r.expireAt, Revision: r.revision, Value: normalize(value)}
+		item.Schema, err = ins.schema(txn, collection, version)
+		return err
+	})
+	return
+}
+
+// Set the item of the collection by the raw id, the value is encoded as the latest type version of the
+// collection, the expiry of the existing item will be kept.
+// The indexes won't be updated, because the index functions only exist in the go program.
+func (ins *Inspector) Set(collection string, id []byte, value interface{}) error {
+	return ins.store.Update(func(txn Txn) error {
+		b, err := lookupCollection(txn, collection)
+		if err != nil {
+			return err
+		}
+
+		version, err := ins.head(txn, collection)
+		if err != nil {
+			return err
+		}
+
+		data, err := msgpack.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		r := &record{data: byframe.EncodeTuple(&version, &data), revision: 1}
+
+		raw, err := b.Get(txn, id)
+		if err == nil {
+			prev, err := decodeRecord(raw)
+			if err != nil {
+				return err
+			}
+			r.expireAt = prev.expireAt
+			r.revision = nextRevision(prev)
+		} else if err != ErrKeyNotFound {
+			return err
+		}
+
+		return ins.store.set(txn, b.Prefix(id), r.encode(), r.expireAt)
+	})
+}
+
+// Delete the item of the collection by the raw id, the index entries of the item will also be removed
+func (ins *Inspector) Delete(collection string, id []byte) error {
+	return ins.store.Update(func(txn Txn) error {
+		b, err := lookupCollection(txn, collection)
+		if err != nil {
+			return err
+		}
+
+		_, err = b.Get(txn, id)
+		if err != nil {
+			return err
+		}
+
+		err = ins.eachIndex(txn, collection, func(_ string, index, rindex *bucket.Bucket) error {
+			i, err := rindex.Get(txn, id)
+			if err == ErrKeyNotFound {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			err = rindex.Delete(txn, id)
+			if err != nil {
+				return err
+			}
+			return index.Delete(txn, append(byframe.Encode(i), id...))
+		})
+		if err != nil {
+			return err
+		}
+
+		return b.Delete(txn, id)
+	})
+}
+
+// Scan iterate the entries of the index, from and to are the encoded index values, such as the
+// output of bytesort.Encode. The entries are in the same order as Index.From, which compares the
+// lengths of the index values first. If to is nil the iteration won't stop until the end of the index.
+// The slices passed to the fn are only valid during the call.
+func (ins *Inspector) Scan(collection, index string, from, to []byte, fn func(index, id []byte) error) error {
+	return ins.store.View(func(txn Txn) error {
+		b, err := bucket.Lookup(txn, []byte(collection+":index:"+index))
+		if err == ErrKeyNotFound {
+			return ErrUnknownCollection
+		} else if err != nil {
+			return err
+		}
+
+		var end []byte
+		if to != nil {
+			end = byframe.Encode(to)
+		}
+
+		return txn.Do(false, b.Prefix(byframe.Encode(from)), func(key []byte) error {
+			if !b.Valid(key) {
+				return ErrStop
+			}
+
+			entry := key[b.Len():]
+			i, n, err := byframe.Decode(entry)
+			if err != nil {
+				return err
+			}
+
+			if end != nil && bytes.Compare(entry[:n], end) > 0 {
+				return ErrStop
+			}
+
+			return fn(i, entry[n:])
+		})
+	})
+}
+
+// Count the number of keys of the bucket, if the name is empty all the keys of the database will be counted
+func (ins *Inspector) Count(name string) (count int, err error) {
+	err = ins.store.View(func(txn Txn) error {
+		if name == "" {
+			return txn.Do(false, nil, func([]byte) error {
+				count++
+				return nil
+			})
+		}
+
+		b, err := bucket.Lookup(txn, []byte(name))
+		if err != nil {
+			return err
+		}
+		count, err = b.Count(txn)
+		return err
+	})
+	return
+}
+
+// Inconsistency a broken entry found by Inspector.Check
+type Inconsistency struct {
+	Collection string
+	Index      string
+	ID         []byte
+	Problem    string
+}
+
+func (i *Inconsistency) String() string {
+	return fmt.Sprintf("%s %s %x: %s", i.Collection, i.Index, i.ID, i.Problem)
+}
+
+// Check the consistency between the items of the list and its indexes in a single read transaction.
+// It checks that each index entry has a reverse entry with the same index value and an item, and each item
+// is indexed. Whether the index values are up to date can't be checked, use Index.Reindex to refresh them.
+func (ins *Inspector) Check(collection string) (list []*Inconsistency, err error) {
+	list = []*Inconsistency{}
+
+	err = ins.store.View(func(txn Txn) error {
+		items, err := lookupCollection(txn, collection)
+		if err != nil {
+			return err
+		}
+
+		return ins.eachIndex(txn, collection, func(name string, index, rindex *bucket.Bucket) error {
+			report := func(id []byte, problem string) {
+				list = append(list, &Inconsistency{
+					Collection: collection, Index: name, ID: append([]byte{}, id...), Problem: problem,
+				})
+			}
+
+			err := txn.Do(false, index.Prefix(nil), func(key []byte) error {
+				if !index.Valid(key) {
+					return ErrStop
+				}
+
+				entry := key[index.Len():]
+				i, n, err := byframe.Decode(entry)
+				if err != nil {
+					return err
+				}
+				id := entry[n:]
+
+				_, err = items.Get(txn, id)
+				if err == ErrKeyNotFound {
+					report(id, "the index entry points to a missing item")
+				} else if err != nil {
+					return err
+				}
+
+				ri, err := rindex.Get(txn, id)
+				if err == ErrKeyNotFound {
+					report(id, "the index entry has no reverse entry")
+				} else if err != nil {
+					return err
+				} else if !bytes.Equal(ri, i) {
+					report(id, "the index entry doesn't match the reverse entry")
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			err = txn.Do(false, rindex.Prefix(nil), func(key []byte) error {
+				if !rindex.Valid(key) {
+					return ErrStop
+				}
+				id := key[rindex.Len():]
+
+				i, err := txn.Get(key)
+				if err != nil {
+					return err
+				}
+
+				_, err = index.Get(txn, append(byframe.Encode(i), id...))
+				if err == ErrKeyNotFound {
+					report(id, "the reverse entry has no index entry")
+				} else if err != nil {
+					return err
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			return txn.Do(false, items.Prefix(nil), func(key []byte) error {
+				if !items.Valid(key) {
+					return ErrStop
+				}
+				id := key[items.Len():]
+
+				_, err := rindex.Get(txn, id)
+				if err == ErrKeyNotFound {
+					report(id, "the item is not indexed")
+					return nil
+				}
+				return err
+			})
+		})
+	})
+	return
+}
+
+func lookupCollection(txn Txn, collection string) (*bucket.Bucket, error) {
+	b, err := bucket.Lookup(txn, []byte(collection))
+	if err == ErrKeyNotFound {
+		return nil, ErrUnknownCollection
+	}
+	return b, err
+}
+
+// iterate the index buckets and the reverse index buckets of the collection
+func (ins *Inspector) eachIndex(txn Txn, collection string, fn func(name string, index, rindex *bucket.Bucket) error) error {
+	names, err := bucket.Names(txn)
+	if err != nil {
+		return err
+	}
+
+	prefix := collection + ":index:"
+	for _, name := range names {
+		if !strings.HasPrefix(string(name), prefix) {
+			continue
+		}
+
+		index, err := bucket.Lookup(txn, name)
+		if err != nil {
+			return err
+		}
+
+		indexName := string(name[len(prefix):])
+		rindex, err := bucket.Lookup(txn, []byte(collection+":rindex:"+indexName))
+		if err != nil {
+			return err
+		}
+
+		err = fn(indexName, index, rindex)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the short version of the latest type of the collection
+func (ins *Inspector) head(txn Txn, collection string) ([]byte, error) {
+	collections, err := bucket.Lookup(txn, []byte(ins.store.name+":collections"))
+	if err == ErrKeyNotFound {
+		return nil, ErrUnknownCollection
+	} else if err != nil {
+		return nil, err
+	}
+
+	ids, err := loadHistory(txn, collections, []byte(collection))
+	if err == ErrKeyNotFound {
+		return nil, ErrUnknownCollection
+	} else if err != nil {
+		return nil, err
+	}
+
+	b, err := bucket.Lookup(txn, ids[0])
+	if err != nil {
+		return nil, err
+	}
+	return b.Prefix(nil), nil
+}
+
+// find the schema of the short version in the history of the collection
+func (ins *Inspector) schema(txn Txn, collection string, version []byte) (*Schema, error) {
+	collections, err := bucket.Lookup(txn, []byte(ins.store.name+":collections"))
+	if err == ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	schemas, err := bucket.Lookup(txn, []byte(ins.store.name+":schema"))
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := loadHistory(txn, collections, []byte(collection))
+	if err == ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		b, err := bucket.Lookup(txn, id)
+		if err == ErrKeyNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(b.Prefix(nil), version) {
+			t, err := schemas.Get(txn, id)
+			if err != nil {
+				return nil, err
+			}
+			return &Schema{ID: id, Type: string(t)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// convert the maps decoded by msgpack to the ones that can be encoded as json
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		dict := map[string]interface{}{}
+		for k, item := range v {
+			dict[fmt.Sprint(k)] = normalize(item)
+		}
+		return dict
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalize(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,107 @@
+package storer_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/nochso/bytesort"
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+type Gadget struct {
+	Name  string
+	Price int
+}
+
+func TestInspector(t *testing.T) {
+	store := storer.New("")
+	gadgets := store.ListWithName("gadgets", &Gadget{})
+	index := gadgets.Index("price", func(g *Gadget) interface{} {
+		return g.Price
+	})
+	a, _ := gadgets.Add(&Gadget{"a", 10})
+	b, _ := gadgets.Add(&Gadget{"b", 20})
+	idA, _ := hex.DecodeString(a)
+	idB, _ := hex.DecodeString(b)
+
+	ins := store.Inspect()
+	name := ":storer_test.Gadget:gadgets"
+
+	list, err := ins.Collections()
+	kit.E(err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, name, list[0].Name)
+	assert.Equal(t, 2, list[0].Count)
+	assert.Equal(t, []string{"price"}, list[0].Indexes)
+
+	item, err := ins.Get(name, idA)
+	kit.E(err)
+	assert.Equal(t, map[string]interface{}{"Name": "a", "Price": int64(10)}, item.Value)
+	assert.Equal(t, list[0].History[0], item.Schema)
+	assert.EqualValues(t, 1, item.Revision)
+
+	kit.E(ins.Set(name, idA, map[string]interface{}{"Name": "c", "Price": 30}))
+	var g Gadget
+	kit.E(gadgets.Get(a, &g))
+	assert.Equal(t, Gadget{"c", 30}, g)
+
+	from, _ := bytesort.Encode(10)
+	to, _ := bytesort.Encode(20)
+	ids := [][]byte{}
+	kit.E(ins.Scan(name, "price", from, to, func(_, id []byte) error {
+		ids = append(ids, append([]byte{}, id...))
+		return nil
+	}))
+	assert.Equal(t, [][]byte{idA, idB}, ids)
+
+	problems, err := ins.Check(name)
+	kit.E(err)
+	assert.Len(t, problems, 0)
+
+	kit.E(ins.Delete(name, idB))
+	assert.Equal(t, storer.ErrNotFound, index.From(20).Find(&g))
+
+	n, err := ins.Count(name + ":index:price")
+	kit.E(err)
+	assert.Equal(t, 1, n)
+
+	_, err = ins.Get(name, idB)
+	assert.Equal(t, storer.ErrKeyNotFound, err)
+	_, err = ins.Get("unknown", idB)
+	assert.Equal(t, storer.ErrUnknownCollection, err)
+}
+
+func TestInspectorCheck(t *testing.T) {
+	store := storer.New("")
+	gadgets := store.ListWithName("gadgets", &Gadget{})
+	_ = gadgets.Index("price", func(g *Gadget) interface{} {
+		return g.Price
+	})
+	a, _ := gadgets.Add(&Gadget{"a", 10})
+	id, _ := hex.DecodeString(a)
+
+	ins := store.Inspect()
+	name := ":storer_test.Gadget:gadgets"
+
+	// break the reverse index
+	list, err := store.Buckets()
+	kit.E(err)
+	kit.E(store.Update(func(txn kvstore.Txn) error {
+		for _, info := range list {
+			if string(info.Name) == name+":rindex:price" {
+				return txn.Delete(append(info.Prefix, id...))
+			}
+		}
+		return nil
+	}))
+
+	problems, err := ins.Check(name)
+	kit.E(err)
+	assert.Len(t, problems, 2)
+	assert.Equal(t, "the index entry has no reverse entry", problems[0].Problem)
+	assert.Equal(t, "the item is not indexed", problems[1].Problem)
+	assert.Equal(t, id, problems[1].ID)
+}
@@ -3,6 +3,7 @@ package storer
 import (
 	"errors"
 	"reflect"
+	"time"
 
 	"github.com/ysmood/storer/pkg/kvstore"
 	"github.com/ysmood/storer/pkg/typee"
@@ -15,6 +16,7 @@ var ErrIndexExists = errors.New("[storer] index already exists")
 type List struct {
 	dict    *Map
 	indexes map[string]*Index
+	genID   IDGen
 }
 
 // ListTxn ...
@@ -33,44 +35,82 @@ func (list *List) Txn(txn kvstore.Txn) *ListTxn {
 
 // AddByBytes add an item to the list, return the id and error
 func (listTxn *ListTxn) AddByBytes(item interface{}) ([]byte, error) {
-	id := typee.GenID(item)
-	err := listTxn.dictTxn.SetByBytes(id, item)
+	return listTxn.AddByBytesWithTTL(item, 0)
+}
+
+// AddByBytesWithTTL add an item that will expire after the ttl, the indexes of the item
+// will be removed when it expires. If the ttl is not positive the item will never expire.
+func (listTxn *ListTxn) AddByBytesWithTTL(item interface{}, ttl time.Duration) ([]byte, error) {
+	id, err := listTxn.list.genID(listTxn.dictTxn.txn, item)
 	if err != nil {
 		return nil, err
 	}
 
+	return id, listTxn.add(id, item, expireAt(ttl))
+}
+
+// add a new item with the id and create its indexes
+func (listTxn *ListTxn) add(id []byte, item interface{}, at int64) error {
+	err := listTxn.dictTxn.set(id, item, at, nextRevision(nil))
+	if err != nil {
+		return err
+	}
+
 	for _, index := range listTxn.list.indexes {
-		err = index.add(listTxn.dictTxn.txn, id, item)
+		err = index.add(listTxn.dictTxn.txn, id, item, at)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	return id, nil
+	return nil
 }
 
 // GetByBytes get item from the list
 func (listTxn *ListTxn) GetByBytes(id []byte, item interface{}) error {
-	err := listTxn.dictTxn.GetByBytes(id, item)
+	_, err := listTxn.get(id, nil, item)
+	return err
+}
+
+func (listTxn *ListTxn) get(id, raw []byte, item interface{}) (*record, error) {
+	r, err := listTxn.dictTxn.get(id, raw, item)
 	if err == typee.ErrMigrated {
-		return listTxn.updateIndex(id, item)
+		return r, listTxn.updateIndex(id, item, r.expireAt, false)
 	}
-	return err
+	return r, err
 }
 
-// SetByBytes update an existing item
+// SetByBytes update an existing item, the item will never expire
 func (listTxn *ListTxn) SetByBytes(id []byte, item interface{}) error {
-	err := listTxn.dictTxn.SetByBytes(id, item)
+	return listTxn.SetByBytesWithTTL(id, item, 0)
+}
+
+// SetByBytesWithTTL update an existing item, it will expire after the ttl.
+// If the ttl is not positive the item will never expire.
+func (listTxn *ListTxn) SetByBytesWithTTL(id []byte, item interface{}, ttl time.Duration) error {
+	prev, err := listTxn.dictTxn.prev(id)
 	if err != nil {
 		return err
 	}
 
-	return listTxn.updateIndex(id, item)
+	return listTxn.set(id, item, expireAt(ttl), prev)
 }
 
-func (listTxn *ListTxn) updateIndex(id []byte, item interface{}) error {
+func (listTxn *ListTxn) set(id []byte, item interface{}, at int64, prev *record) error {
+	err := listTxn.dictTxn.set(id, item, at, nextRevision(prev))
+	if err != nil {
+		return err
+	}
+
+	// the native TTL of the index entries must be refreshed
+	refresh := at != 0 || (prev != nil && prev.expireAt != 0)
+
+	return listTxn.updateIndex(id, item, at, refresh)
+}
+
+func (listTxn *ListTxn) updateIndex(id []byte, item interface{}, expireAt int64, refresh bool) error {
 	for _, index := range listTxn.list.indexes {
-		err := index.update(listTxn.dictTxn.txn, id, item)
+		err := index.update(listTxn.dictTxn.txn, id, item, expireAt, refresh)
 		if err != nil {
 			return err
 		}
@@ -96,6 +136,18 @@ func (listTxn *ListTxn) DelByBytes(id []byte) error {
 	return listTxn.dictTxn.DelByBytes(id)
 }
 
+// remove the expired item and its indexes
+func (list *List) expire(txn kvstore.Txn, id []byte) error {
+	for _, index := range list.indexes {
+		err := index.del(txn, id)
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+	}
+
+	return list.dict.Txn(txn).DelByBytes(id)
+}
+
 // IndexByBytes byte version of Index
 func (listTxn *ListTxn) IndexByBytes(name string, fn GenIndexBytes) (*Index, error) {
 	_, has := listTxn.list.indexes[name]
@@ -104,29 +156,28 @@ func (listTxn *ListTxn) IndexByBytes(name string, fn GenIndexBytes) (*Index, err
 	}
 
 	index := &Index{
-		name: name,
-		list: listTxn.list,
-		bucket: listTxn.list.dict.store.bucket(
-			listTxn.list.dict.typeID.Anchor,
-			listTxn.list.dict.name,
-			"index",
-			name,
-		),
-		rbucket: listTxn.list.dict.store.bucket(
-			listTxn.list.dict.typeID.Anchor,
-			listTxn.list.dict.name,
-			"rindex",
-			name,
-		),
+		name:     name,
+		list:     listTxn.list,
 		genIndex: fn,
 	}
 
+	err := index.open()
+	if err != nil {
+		return nil, err
+	}
+
 	listTxn.list.indexes[name] = index
 
 	return index, nil
 }
 
-// Each ...
+// Each iterate the ids of the items by their byte-wise order
 func (listTxn *ListTxn) Each(fn MapEach) error {
 	return listTxn.dictTxn.Each(fn)
 }
+
+// EachFrom iterate the ids of the items from the id, such as use a time prefix from
+// pkg/idgen to scan the items created after a point in time
+func (listTxn *ListTxn) EachFrom(from []byte, fn MapEach) error {
+	return listTxn.dictTxn.EachFrom(from, fn)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"reflect"
+	"time"
 
 	"github.com/nochso/bytesort"
 	"github.com/ysmood/kit/pkg/utils"
@@ -39,6 +40,21 @@ func (list *List) Add(item interface{}) (id string, err error) {
 	return
 }
 
+// AddWithTTL string version of AddByBytesWithTTL
+func (listTxn *ListTxn) AddWithTTL(item interface{}, ttl time.Duration) (string, error) {
+	id, err := listTxn.AddByBytesWithTTL(item, ttl)
+	return hex.EncodeToString(id), err
+}
+
+// AddWithTTL auto transaction version of ListTxn.AddWithTTL
+func (list *List) AddWithTTL(item interface{}, ttl time.Duration) (id string, err error) {
+	err = list.Update(func(txn *ListTxn) error {
+		id, err = txn.AddWithTTL(item, ttl)
+		return err
+	})
+	return
+}
+
 // Get auto transaction version of ListTxn.Get
 func (list *List) Get(id string, item interface{}) (err error) {
 	err = list.View(func(txn *ListTxn) error {
@@ -54,6 +70,13 @@ func (list *List) Set(id string, item interface{}) error {
 	})
 }
 
+// SetWithTTL auto transaction version of ListTxn.SetWithTTL
+func (list *List) SetWithTTL(id string, item interface{}, ttl time.Duration) error {
+	return list.Update(func(txn *ListTxn) error {
+		return txn.SetWithTTL(id, item, ttl)
+	})
+}
+
 // Del auto transaction version of ListTxn.Del
 func (list *List) Del(id string) error {
 	return list.Update(func(txn *ListTxn) error {
@@ -80,6 +103,16 @@ func (listTxn *ListTxn) Set(id string, item interface{}) error {
 	return listTxn.SetByBytes(b, item)
 }
 
+// SetWithTTL string version of SetByBytesWithTTL
+func (listTxn *ListTxn) SetWithTTL(id string, item interface{}, ttl time.Duration) error {
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return err
+	}
+
+	return listTxn.SetByBytesWithTTL(b, item, ttl)
+}
+
 // Del string version of DelByte
 func (listTxn *ListTxn) Del(id string) error {
 	b, err := hex.DecodeString(id)
@@ -3,6 +3,8 @@ package storer
 import (
 	"errors"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/ysmood/storer/pkg/bucket"
 	"github.com/ysmood/storer/pkg/kvstore"
@@ -19,6 +21,16 @@ type Map struct {
 	store  *Store
 	typeID *typee.TypeID
 	bucket *bucket.Bucket
+
+	// expiryKind the owner kind used by the expiry index
+	expiryKind expiryKind
+
+	// expiry the expiry index for backends that don't support TTL natively, it's created on demand
+	expiry     *bucket.Bucket
+	expiryLock sync.Mutex
+
+	// pin the type id of the pinned write version, nil means the latest version
+	pin []byte
 }
 
 // MapTxn ...
@@ -37,39 +49,133 @@ func (dict *Map) Txn(txn kvstore.Txn) *MapTxn {
 
 // SetByBytes set an item to the map
 func (dictTxn *MapTxn) SetByBytes(id []byte, item interface{}) error {
+	return dictTxn.SetByBytesWithTTL(id, item, 0)
+}
+
+// SetByBytesWithTTL set an item that will expire after the ttl, if the ttl is not positive
+// the item will never expire
+func (dictTxn *MapTxn) SetByBytesWithTTL(id []byte, item interface{}, ttl time.Duration) error {
+	prev, err := dictTxn.prev(id)
+	if err != nil {
+		return err
+	}
+	return dictTxn.set(id, item, expireAt(ttl), nextRevision(prev))
+}
+
+func (dictTxn *MapTxn) set(id []byte, item interface{}, expireAt int64, revision uint64) error {
 	if dictTxn.dict.typeID.Type != reflect.TypeOf(item).Elem() {
 		return ErrItemType
 	}
 
-	data, err := typee.Encode(item, dictTxn.typeIDMapper)
+	data, err := dictTxn.encode(item)
+	if err != nil {
+		return err
+	}
+
+	r := &record{expireAt: expireAt, revision: revision, data: data}
+	key := dictTxn.dict.bucket.Prefix(id)
+
+	err = dictTxn.dict.store.set(dictTxn.txn, key, r.encode(), expireAt)
 	if err != nil {
 		return err
 	}
 
-	return dictTxn.txn.Set(dictTxn.dict.bucket.Prefix(id), data)
+	return dictTxn.dict.track(dictTxn.txn, key, expireAt)
 }
 
 // GetByBytes get item from the map
 func (dictTxn *MapTxn) GetByBytes(id []byte, item interface{}) error {
+	_, err := dictTxn.get(id, nil, item)
+	return err
+}
+
+// get item from the raw record, if raw is nil it will be loaded from the database
+func (dictTxn *MapTxn) get(id, raw []byte, item interface{}) (*record, error) {
 	if dictTxn.dict.typeID.Type != reflect.TypeOf(item).Elem() {
-		return ErrItemType
+		return nil, ErrItemType
 	}
 
-	raw, err := dictTxn.txn.Get(dictTxn.dict.bucket.Prefix(id))
+	r, err := dictTxn.record(id, raw)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = typee.Decode(raw, item, dictTxn.typeIDMapper)
-	if err == typee.ErrMigrated {
-		// so that same migration won't happen again
-		err = dictTxn.dict.SetByBytes(id, item)
+
+	err = typee.DecodeTolerant(r.data, item, dictTxn.typeIDMapper, dictTxn.tolerate)
+	if err != nil && err != typee.ErrMigrated {
+		return nil, err
+	}
+
+	stale := err == typee.ErrMigrated
+	if dictTxn.dict.pin != nil {
+		stale, err = dictTxn.stale(r.data)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	if stale {
+		// so that same migration won't happen again, the revision won't change
+		// because the content of the item is the same
+		err = dictTxn.dict.store.Update(func(txn Txn) error {
+			return dictTxn.dict.Txn(txn).set(id, item, r.expireAt, r.revision)
+		})
+		if err != nil {
+			return nil, err
 		}
 		// upper data structure should also handle this
-		return typee.ErrMigrated
+		return r, typee.ErrMigrated
 	}
-	return err
+	return r, nil
+}
+
+// prev load the current record before overwriting it, nil means the record doesn't exist
+func (dictTxn *MapTxn) prev(id []byte) (*record, error) {
+	r, err := dictTxn.record(id, nil)
+	if err == ErrKeyNotFound {
+		return nil, nil
+	}
+	return r, err
+}
+
+// record load the record of the id, expired record will be treated as not found
+func (dictTxn *MapTxn) record(id, raw []byte) (*record, error) {
+	if raw == nil {
+		var err error
+		raw, err = dictTxn.txn.Get(dictTxn.dict.bucket.Prefix(id))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := decodeRecord(raw)
+	if err != nil {
+		return nil, err
+	}
+	if r.expired() {
+		return nil, ErrKeyNotFound
+	}
+	return r, nil
+}
+
+// alive checks if the item is not expired. When the backend supports TTL natively it's always true.
+// The raw record will be returned so that it can be reused.
+func (dictTxn *MapTxn) alive(id []byte) (bool, []byte, error) {
+	if nativeTTL(dictTxn.txn) {
+		return true, nil, nil
+	}
+
+	raw, err := dictTxn.txn.Get(dictTxn.dict.bucket.Prefix(id))
+	if err == ErrKeyNotFound {
+		return true, nil, nil
+	} else if err != nil {
+		return false, nil, err
+	}
+
+	r, err := decodeRecord(raw)
+	if err != nil {
+		return false, nil, err
+	}
+	return !r.expired(), raw, nil
 }
 
 // DelByBytes remove a item from the map
@@ -82,12 +188,24 @@ type MapEach func(id []byte) error
 
 // Each ...
 func (dictTxn *MapTxn) Each(fn MapEach) error {
-	return dictTxn.txn.Do(false, dictTxn.dict.bucket.Prefix(nil), func(key []byte) error {
+	return dictTxn.EachFrom(nil, fn)
+}
+
+// EachFrom iterate the ids that are greater than or equal to from
+func (dictTxn *MapTxn) EachFrom(from []byte, fn MapEach) error {
+	return dictTxn.txn.Do(false, dictTxn.dict.bucket.Prefix(from), func(key []byte) error {
 		if !dictTxn.dict.bucket.Valid(key) {
 			return ErrStop
 		}
 
-		return fn(key[dictTxn.dict.bucket.Len():])
+		id := key[dictTxn.dict.bucket.Len():]
+
+		alive, _, err := dictTxn.alive(id)
+		if err != nil || !alive {
+			return err
+		}
+
+		return fn(id)
 	})
 }
 
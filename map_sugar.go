@@ -1,10 +1,17 @@
 package storer
 
+import "time"
+
 // Set string version of MapTxn.SetByBytes
 func (t *MapTxn) Set(id string, item interface{}) error {
 	return t.SetByBytes([]byte(id), item)
 }
 
+// SetWithTTL string version of MapTxn.SetByBytesWithTTL
+func (t *MapTxn) SetWithTTL(id string, item interface{}, ttl time.Duration) error {
+	return t.SetByBytesWithTTL([]byte(id), item, ttl)
+}
+
 // Get string version of MapTxn.GetByBytes
 func (t *MapTxn) Get(id string, item interface{}) error {
 	return t.GetByBytes([]byte(id), item)
@@ -22,6 +29,13 @@ func (m *Map) SetByBytes(id []byte, item interface{}) error {
 	})
 }
 
+// SetByBytesWithTTL ...
+func (m *Map) SetByBytesWithTTL(id []byte, item interface{}, ttl time.Duration) error {
+	return m.store.Update(func(txn Txn) error {
+		return m.Txn(txn).SetByBytesWithTTL(id, item, ttl)
+	})
+}
+
 // GetByBytes ...
 func (m *Map) GetByBytes(id []byte, item interface{}) error {
 	return m.store.View(func(txn Txn) error {
@@ -41,6 +55,11 @@ func (m *Map) Set(id string, item interface{}) error {
 	return m.SetByBytes([]byte(id), item)
 }
 
+// SetWithTTL ...
+func (m *Map) SetWithTTL(id string, item interface{}, ttl time.Duration) error {
+	return m.SetByBytesWithTTL([]byte(id), item, ttl)
+}
+
 // Get ...
 func (m *Map) Get(id string, item interface{}) error {
 	return m.GetByBytes([]byte(id), item)
@@ -0,0 +1,221 @@
+package storer
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/typee"
+)
+
+// the default number of records to migrate in a single transaction
+const migrateBatch = 100
+
+// MigrationProgress ...
+type MigrationProgress struct {
+	// Total the number of records when the migration starts
+	Total int
+	// Scanned the number of records that have been checked
+	Scanned int
+	// Migrated the number of records that have been rewritten
+	Migrated int
+	// Done whether the migration is finished
+	Done bool
+}
+
+// Migrator walks through a collection and rewrites every stale record to the latest type version
+// in the background. Each batch of records is migrated in its own transaction.
+type Migrator struct {
+	total    int64
+	scanned  int64
+	migrated int64
+
+	done chan struct{}
+	err  error
+	lock sync.Mutex
+}
+
+// the function to migrate a single record, returns true if the record is rewritten
+type migrateRecord func(txn kvstore.Txn, id []byte, r *record) (bool, error)
+
+// Migrate start a background migration of the map, if batch is not positive 100 will be used.
+// Once the migration is done, old Precedent types are only needed to read the records
+// written by old binaries. If the map is pinned, the records will be downgraded to the pinned version.
+func (m *Map) Migrate(batch int) *Migrator {
+	return m.migrate(batch, func(txn kvstore.Txn, id []byte, r *record) (bool, error) {
+		_, migrated, err := m.Txn(txn).upgrade(id, r)
+		return migrated, err
+	})
+}
+
+// Migrate start a background migration of the list, the indexes of the migrated items will also be updated.
+// If batch is not positive 100 will be used.
+func (list *List) Migrate(batch int) *Migrator {
+	return list.dict.migrate(batch, func(txn kvstore.Txn, id []byte, r *record) (bool, error) {
+		listTxn := list.Txn(txn)
+
+		item, migrated, err := listTxn.dictTxn.upgrade(id, r)
+		if err != nil || !migrated {
+			return migrated, err
+		}
+
+		return true, listTxn.updateIndex(id, item, r.expireAt, false)
+	})
+}
+
+// Outdated count the records that are not on the latest type version, or the pinned version if the map is pinned
+func (m *Map) Outdated() (count int, err error) {
+	err = m.store.View(func(txn Txn) error {
+		dictTxn := m.Txn(txn)
+
+		return dictTxn.Each(func(id []byte) error {
+			r, err := dictTxn.record(id, nil)
+			if err != nil {
+				return err
+			}
+
+			stale, err := dictTxn.stale(r.data)
+			if stale {
+				count++
+			}
+			return err
+		})
+	})
+	return
+}
+
+// Outdated count the items that are not on the latest type version, or the pinned version if the list is pinned
+func (list *List) Outdated() (int, error) {
+	return list.dict.Outdated()
+}
+
+// upgrade the record in the same transaction if it's not on the write version,
+// the expiry and revision of the record won't change
+func (dictTxn *MapTxn) upgrade(id []byte, r *record) (interface{}, bool, error) {
+	stale, err := dictTxn.stale(r.data)
+	if err != nil || !stale {
+		return nil, false, err
+	}
+
+	item := reflect.New(dictTxn.dict.typeID.Type).Interface()
+	err = typee.DecodeTolerant(r.data, item, dictTxn.typeIDMapper, dictTxn.tolerate)
+	if err != nil && err != typee.ErrMigrated {
+		return nil, false, err
+	}
+
+	return item, true, dictTxn.set(id, item, r.expireAt, r.revision)
+}
+
+func (m *Map) migrate(batch int, fn migrateRecord) *Migrator {
+	if batch <= 0 {
+		batch = migrateBatch
+	}
+
+	migrator := &Migrator{done: make(chan struct{})}
+
+	go func() {
+		err := migrator.run(m, batch, fn)
+
+		migrator.lock.Lock()
+		migrator.err = err
+		migrator.lock.Unlock()
+
+		close(migrator.done)
+	}()
+
+	return migrator
+}
+
+func (migrator *Migrator) run(m *Map, batch int, fn migrateRecord) error {
+	err := m.store.View(func(txn Txn) error {
+		n, err := m.bucket.Count(txn)
+		atomic.StoreInt64(&migrator.total, int64(n))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var from []byte
+	for {
+		var ids [][]byte
+
+		err := m.store.Update(func(txn Txn) error {
+			dictTxn := m.Txn(txn)
+
+			ids = [][]byte{}
+			err := txn.Do(false, m.bucket.Prefix(from), func(key []byte) error {
+				if !m.bucket.Valid(key) || len(ids) == batch {
+					return ErrStop
+				}
+				ids = append(ids, append([]byte{}, key[m.bucket.Len():]...))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, id := range ids {
+				r, err := dictTxn.record(id, nil)
+				if err == ErrKeyNotFound {
+					continue
+				} else if err != nil {
+					return err
+				}
+
+				migrated, err := fn(txn, id, r)
+				if err != nil {
+					return err
+				}
+				if migrated {
+					atomic.AddInt64(&migrator.migrated, 1)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		atomic.AddInt64(&migrator.scanned, int64(len(ids)))
+
+		if len(ids) < batch {
+			return nil
+		}
+
+		// the smallest key after the last id
+		from = append(ids[len(ids)-1], 0)
+	}
+}
+
+// Progress get the current progress of the migration
+func (migrator *Migrator) Progress() MigrationProgress {
+	done := false
+	select {
+	case <-migrator.done:
+		done = true
+	default:
+	}
+
+	return MigrationProgress{
+		Total:    int(atomic.LoadInt64(&migrator.total)),
+		Scanned:  int(atomic.LoadInt64(&migrator.scanned)),
+		Migrated: int(atomic.LoadInt64(&migrator.migrated)),
+		Done:     done,
+	}
+}
+
+// Done the channel will be closed when the migration is finished
+func (migrator *Migrator) Done() <-chan struct{} {
+	return migrator.done
+}
+
+// Wait until the migration is finished, returns the error that stops the migration
+func (migrator *Migrator) Wait() error {
+	<-migrator.done
+
+	migrator.lock.Lock()
+	defer migrator.lock.Unlock()
+	return migrator.err
+}
@@ -0,0 +1,217 @@
+package storer_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/byframe"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/badger"
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/typee"
+)
+
+type ProfileV0 struct {
+	Age int
+}
+
+type Profile struct {
+	Age string
+}
+
+var _ typee.Migratable = &Profile{}
+
+func (p *Profile) Precedent() interface{} { return &ProfileV0{} }
+
+func (p *Profile) Migrate(item interface{}) {
+	p.Age = fmt.Sprint(item.(*ProfileV0).Age)
+}
+
+var _ typee.Downgradable = &Profile{}
+
+func (p *Profile) Downgrade(item interface{}) {
+	item.(*ProfileV0).Age, _ = strconv.Atoi(p.Age)
+}
+
+// move the buckets written by the old type to the anchor of the new type, just like an old binary wrote them
+func upgradeBuckets(store *storer.Store, names ...string) {
+	kit.E(store.Update(func(txn kvstore.Txn) error {
+		for _, name := range names {
+			err := bucket.Rename(txn, []byte(":storer_test.ProfileV0:"+name), []byte(":storer_test.Profile:"+name))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func TestMapMigrate(t *testing.T) {
+	store := storer.New("")
+	old := store.MapWithName("profiles", &ProfileV0{})
+	for i := 0; i < 25; i++ {
+		kit.E(old.Set(fmt.Sprint(i), &ProfileV0{i}))
+	}
+	upgradeBuckets(store, "profiles")
+
+	profiles := store.MapWithName("profiles", &Profile{})
+	n, err := profiles.Outdated()
+	kit.E(err)
+	assert.Equal(t, 25, n)
+
+	migrator := profiles.Migrate(10)
+	kit.E(migrator.Wait())
+
+	assert.Equal(t, storer.MigrationProgress{Total: 25, Scanned: 25, Migrated: 25, Done: true}, migrator.Progress())
+
+	n, err = profiles.Outdated()
+	kit.E(err)
+	assert.Equal(t, 0, n)
+
+	var p Profile
+	kit.E(profiles.Get("3", &p))
+	assert.Equal(t, "3", p.Age)
+
+	// run again on the up to date map
+	migrator = profiles.Migrate(0)
+	<-migrator.Done()
+	assert.Equal(t, 0, migrator.Progress().Migrated)
+}
+
+func TestListMigrate(t *testing.T) {
+	store := storer.New("")
+	old := store.ListWithName("profiles", &ProfileV0{})
+	_ = old.Index("age", func(p *ProfileV0) interface{} {
+		return p.Age
+	})
+	for i := 0; i < 5; i++ {
+		_, _ = old.Add(&ProfileV0{i})
+	}
+	upgradeBuckets(store, "profiles", "profiles:index:age", "profiles:rindex:age")
+
+	profiles := store.ListWithName("profiles", &Profile{})
+	index := profiles.Index("age", func(p *Profile) interface{} {
+		return p.Age
+	})
+
+	var p Profile
+	assert.Equal(t, storer.ErrNotFound, index.From("3").Find(&p))
+
+	kit.E(profiles.Migrate(2).Wait())
+
+	kit.E(index.From("3").Find(&p))
+	assert.Equal(t, "3", p.Age)
+
+	n, err := profiles.Outdated()
+	kit.E(err)
+	assert.Equal(t, 0, n)
+}
+
+func TestMapDowngrade(t *testing.T) {
+	store := storer.New("")
+	profiles := store.MapWithName("profiles", &Profile{})
+	for i := 0; i < 5; i++ {
+		kit.E(profiles.Set(fmt.Sprint(i), &Profile{fmt.Sprint(i)}))
+	}
+
+	// pinning an unrelated type creates nothing
+	buckets, err := store.Buckets()
+	kit.E(err)
+	assert.Equal(t, typee.ErrUnknownVersion, profiles.Pin(&User{}))
+	after, err := store.Buckets()
+	kit.E(err)
+	assert.Equal(t, len(buckets), len(after))
+
+	kit.E(profiles.Pin(&ProfileV0{}))
+
+	n, err := profiles.Outdated()
+	kit.E(err)
+	assert.Equal(t, 5, n)
+
+	// lazily downgrade the item that is read
+	var p Profile
+	assert.Equal(t, typee.ErrMigrated, profiles.Get("1", &p))
+	assert.Equal(t, "1", p.Age)
+	kit.E(profiles.Get("1", &p))
+
+	// the migration doesn't change the version
+	v, err := profiles.GetWithVersion("2", &p)
+	kit.E(err)
+	assert.Equal(t, uint64(1), v)
+	assert.Equal(t, "2", p.Age)
+
+	kit.E(profiles.Set("5", &Profile{"5"}))
+
+	n, err = profiles.Outdated()
+	kit.E(err)
+	assert.Equal(t, 3, n)
+
+	kit.E(profiles.Migrate(0).Wait())
+
+	n, err = profiles.Outdated()
+	kit.E(err)
+	assert.Equal(t, 0, n)
+
+	// the old binary can read all the records
+	kit.E(store.Update(func(txn kvstore.Txn) error {
+		return bucket.Rename(txn, []byte(":storer_test.Profile:profiles"), []byte(":storer_test.ProfileV0:profiles"))
+	}))
+	old := store.MapWithName("profiles", &ProfileV0{})
+	var p0 ProfileV0
+	kit.E(old.Get("3", &p0))
+	assert.Equal(t, 3, p0.Age)
+	kit.E(old.Get("5", &p0))
+	assert.Equal(t, 5, p0.Age)
+
+	// the latest binary can still read the downgraded records
+	upgradeBuckets(store, "profiles")
+	profiles.Unpin()
+	assert.Equal(t, typee.ErrMigrated, profiles.Get("3", &p))
+	assert.Equal(t, "3", p.Age)
+}
+
+func TestLegacyRecord(t *testing.T) {
+	db := &TestStore{badger: badger.New("")}
+	store := storer.NewWithDB("", db)
+	name := kit.RandString(10)
+	users := store.MapWithName(name, &User{})
+	typeID := typee.GenTypeID(&User{})
+
+	// the record written by the versions before the v2 type id scheme
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		b, err := bucket.Lookup(txn, []byte(":"+typeID.Anchor+":"+name))
+		kit.E(err)
+		legacy, err := bucket.New(txn, typeID.Legacy)
+		kit.E(err)
+		version := legacy.Prefix(nil)
+		data, _ := (&User{"a", 1}).Encode()
+		return txn.Set(b.Prefix([]byte("a")), byframe.EncodeTuple(&version, &data))
+	}))
+
+	// it's outdated until the next write
+	n, err := users.Outdated()
+	kit.E(err)
+	assert.Equal(t, 1, n)
+
+	// read and write it in the same transaction
+	kit.E(store.Update(func(txn kvstore.Txn) error {
+		usersTxn := users.Txn(txn)
+		var u User
+		kit.E(usersTxn.GetByBytes([]byte("a"), &u))
+		assert.Equal(t, User{"a", 1}, u)
+		u.Level++
+		return usersTxn.SetByBytes([]byte("a"), &u)
+	}))
+
+	var u User
+	kit.E(users.Get("a", &u))
+	assert.Equal(t, 2, u.Level)
+
+	n, err = users.Outdated()
+	kit.E(err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,219 @@
+// Package backup streams a consistent snapshot of a kvstore.Store in a portable format,
+// the snapshot can be restored into any kvstore.Store.
+//
+// The format is a sequence of byframe frames. The first frame is the header, each of the following frames
+// is an entry of a key, the last frame is the trailer with the number of entries and the version of the snapshot.
+// A backup without the trailer is treated as truncated.
+package backup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ysmood/byframe"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// Magic the first bytes of the header frame
+const Magic = "storer-backup"
+
+// FormatVersion the version of the backup format
+const FormatVersion = 1
+
+const (
+	kindSet byte = iota
+	kindDelete
+	kindEnd
+)
+
+// the max number of entries to restore in a single transaction
+const restoreBatch = 1000
+
+// ErrFormat ...
+var ErrFormat = errors.New("[storer.backup] not a valid backup")
+
+// ErrTruncated ...
+var ErrTruncated = errors.New("[storer.backup] the backup is truncated")
+
+// ErrIncremental ...
+var ErrIncremental = errors.New("[storer.backup] the backend doesn't support incremental backup")
+
+// Backup stream all the keys of the db to the writer in a single read transaction.
+// Returns the version of the snapshot, which can be used as the since of the next incremental backup.
+// If the db doesn't implement kvstore.Versioned the version will be zero.
+func Backup(db kvstore.Store, w io.Writer) (uint64, error) {
+	return BackupSince(db, w, 0)
+}
+
+// BackupSince stream the keys changed after the since version, the deleted keys will also be recorded.
+// If since is zero it's a full backup. Only the backends that implement kvstore.Versioned support
+// incremental backup, otherwise ErrIncremental will be returned.
+func BackupSince(db kvstore.Store, w io.Writer, since uint64) (uint64, error) {
+	versioned, ok := db.(kvstore.Versioned)
+	if !ok && since != 0 {
+		return 0, ErrIncremental
+	}
+
+	buf := bufio.NewWriter(w)
+
+	err := writeFrame(buf, []byte(Magic), []byte{FormatVersion}, uvarint(since))
+	if err != nil {
+		return 0, err
+	}
+
+	count := uint64(0)
+	write := func(change *kvstore.Change) error {
+		count++
+		kind := kindSet
+		if change.Deleted {
+			kind = kindDelete
+		}
+		return writeFrame(buf, []byte{kind}, change.Key, change.Value, uvarint(change.ExpiresAt))
+	}
+
+	var version uint64
+	if ok {
+		version, err = versioned.Changes(since, write)
+	} else {
+		err = db.Do(false, func(txn kvstore.Txn) error {
+			return txn.Do(false, nil, func(key []byte) error {
+				value, err := txn.Get(key)
+				if err != nil {
+					return err
+				}
+				return write(&kvstore.Change{Key: append([]byte{}, key...), Value: value})
+			})
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// the trailer has the same shape as the entries, the key is empty
+	err = writeFrame(buf, []byte{kindEnd}, nil, uvarint(count), uvarint(version))
+	if err != nil {
+		return 0, err
+	}
+
+	return version, buf.Flush()
+}
+
+// Restore load the backup into the db in batches of transactions, the incremental backups should be
+// restored in order after the full backup. The expired keys will be skipped, if the txn of the db implements
+// kvstore.TTLTxn the keys with expiry will be set with the rest ttl.
+// Returns the version of the backup.
+func Restore(r io.Reader, db kvstore.Store) (uint64, error) {
+	reader := bufio.NewReader(r)
+
+	frame, err := readFrame(reader)
+	if err != nil {
+		return 0, err
+	}
+
+	var magic, formatVersion, since []byte
+	err = byframe.DecodeTuple(frame, &magic, &formatVersion, &since)
+	if err != nil || string(magic) != Magic || len(formatVersion) != 1 || formatVersion[0] != FormatVersion {
+		return 0, ErrFormat
+	}
+
+	count := uint64(0)
+	for {
+		var version uint64
+		done := false
+
+		err := db.Do(true, func(txn kvstore.Txn) error {
+			for i := 0; i < restoreBatch; i++ {
+				frame, err := readFrame(reader)
+				if err != nil {
+					return err
+				}
+
+				var kind, key, value, expiresAt []byte
+				err = byframe.DecodeTuple(frame, &kind, &key, &value, &expiresAt)
+				if err != nil || len(kind) != 1 {
+					return ErrFormat
+				}
+
+				switch kind[0] {
+				case kindEnd:
+					n, _ := binary.Uvarint(value)
+					if n != count {
+						return ErrFormat
+					}
+					version, _ = binary.Uvarint(expiresAt)
+					done = true
+					return nil
+				case kindDelete:
+					err = txn.Delete(key)
+				case kindSet:
+					at, _ := binary.Uvarint(expiresAt)
+					err = set(txn, key, value, at)
+				default:
+					return ErrFormat
+				}
+				if err != nil {
+					return err
+				}
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		if done {
+			return version, nil
+		}
+	}
+}
+
+func set(txn kvstore.Txn, key, value []byte, expiresAt uint64) error {
+	if expiresAt == 0 {
+		return txn.Set(key, value)
+	}
+
+	ttl := time.Until(time.Unix(int64(expiresAt), 0))
+	if ttl <= 0 {
+		return nil
+	}
+
+	if ttlTxn, ok := txn.(kvstore.TTLTxn); ok {
+		return ttlTxn.SetWithTTL(key, value, ttl)
+	}
+	return txn.Set(key, value)
+}
+
+func writeFrame(w io.Writer, items ...[]byte) error {
+	list := make([]*[]byte, len(items))
+	for i := range items {
+		list[i] = &items[i]
+	}
+	_, err := w.Write(byframe.Encode(byframe.EncodeTuple(list...)))
+	return err
+}
+
+func uvarint(n uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutUvarint(b, n)]
+}
+
+// the header of a byframe frame is the same as uvarint
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrTruncated
+	} else if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, l)
+	_, err = io.ReadFull(r, frame)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrTruncated
+	}
+	return frame, err
+}
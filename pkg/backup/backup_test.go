@@ -0,0 +1,113 @@
+package backup_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer/pkg/backup"
+	"github.com/ysmood/storer/pkg/badger"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// a store that doesn't implement kvstore.Versioned
+type plain struct {
+	kvstore.Store
+}
+
+func dump(db kvstore.Store) map[string]string {
+	dict := map[string]string{}
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		return txn.Do(false, nil, func(key []byte) error {
+			value, err := txn.Get(key)
+			dict[string(key)] = string(value)
+			return err
+		})
+	}))
+	return dict
+}
+
+func set(db kvstore.Store, kvs ...string) {
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		for i := 0; i < len(kvs); i += 2 {
+			err := txn.Set([]byte(kvs[i]), []byte(kvs[i+1]))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	for _, db := range []kvstore.Store{badger.New(""), &plain{badger.New("")}} {
+		for i := 0; i < 2500; i++ {
+			set(db, fmt.Sprint(i), fmt.Sprint(i*2))
+		}
+		set(db, "empty", "")
+
+		buf := bytes.NewBuffer(nil)
+		_, err := backup.Backup(db, buf)
+		kit.E(err)
+
+		target := badger.New("")
+		_, err = backup.Restore(buf, target)
+		kit.E(err)
+
+		assert.Equal(t, dump(db), dump(target))
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	db := badger.New("")
+	set(db, "a", "1", "b", "2", "c", "3")
+
+	full := bytes.NewBuffer(nil)
+	version, err := backup.Backup(db, full)
+	kit.E(err)
+
+	set(db, "b", "4", "d", "5")
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		return txn.Delete([]byte("a"))
+	}))
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		return txn.(kvstore.TTLTxn).SetWithTTL([]byte("e"), []byte("6"), time.Hour)
+	}))
+
+	inc := bytes.NewBuffer(nil)
+	next, err := backup.BackupSince(db, inc, version)
+	kit.E(err)
+	assert.True(t, next > version)
+
+	target := badger.New("")
+	_, err = backup.Restore(full, target)
+	kit.E(err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2", "c": "3"}, dump(target))
+
+	restored, err := backup.Restore(inc, target)
+	kit.E(err)
+	assert.Equal(t, next, restored)
+	assert.Equal(t, dump(db), dump(target))
+	assert.Equal(t, map[string]string{"b": "4", "c": "3", "d": "5", "e": "6"}, dump(target))
+
+	_, err = backup.BackupSince(&plain{db}, inc, version)
+	assert.Equal(t, backup.ErrIncremental, err)
+}
+
+func TestRestoreErr(t *testing.T) {
+	db := badger.New("")
+	set(db, "a", "1")
+
+	buf := bytes.NewBuffer(nil)
+	_, err := backup.Backup(db, buf)
+	kit.E(err)
+
+	_, err = backup.Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-2]), badger.New(""))
+	assert.Equal(t, backup.ErrTruncated, err)
+
+	_, err = backup.Restore(bytes.NewReader([]byte("\x03abc")), badger.New(""))
+	assert.Equal(t, backup.ErrFormat, err)
+}
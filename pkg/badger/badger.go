@@ -1,8 +1,10 @@
 package badger
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/dgraph-io/badger/v2"
 	"github.com/ysmood/kit/pkg/utils"
@@ -15,6 +17,7 @@ type Badger struct {
 }
 
 var _ kvstore.Store = &Badger{}
+var _ kvstore.Versioned = &Badger{}
 
 // New a helper to create a badger adapter instance.
 // If the dir is empty a tmp dir will be created.
@@ -58,6 +61,52 @@ func (b *Badger) Do(update bool, fn kvstore.DoTxn) error {
 	return nil
 }
 
+// Changes the version is the commit timestamp of badger
+func (b *Badger) Changes(since uint64, fn func(change *kvstore.Change) error) (uint64, error) {
+	txn := b.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(badger.IteratorOptions{AllVersions: true})
+	defer it.Close()
+
+	var last []byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+
+		// only the latest version of each key matters
+		if last != nil && bytes.Equal(last, item.Key()) {
+			continue
+		}
+		last = item.KeyCopy(last)
+
+		if item.Version() <= since {
+			continue
+		}
+
+		change := &kvstore.Change{Key: item.KeyCopy(nil), ExpiresAt: item.ExpiresAt()}
+
+		if item.IsDeletedOrExpired() {
+			if since == 0 {
+				continue
+			}
+			change.Deleted = true
+		} else {
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return 0, err
+			}
+			change.Value = value
+		}
+
+		err := fn(change)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return txn.ReadTs(), nil
+}
+
 // Close ...
 func (b *Badger) Close() error {
 	return b.db.Close()
@@ -68,7 +117,7 @@ type Txn struct {
 	txn *badger.Txn
 }
 
-var _ kvstore.Txn = &Txn{}
+var _ kvstore.TTLTxn = &Txn{}
 
 // Get ...
 func (t *Txn) Get(key []byte) ([]byte, error) {
@@ -87,6 +136,11 @@ func (t *Txn) Set(key, value []byte) error {
 	return t.txn.Set(key, value)
 }
 
+// SetWithTTL ...
+func (t *Txn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	return t.txn.SetEntry(badger.NewEntry(key, value).WithTTL(ttl))
+}
+
 // Delete ...
 func (t *Txn) Delete(key []byte) error {
 	return t.txn.Delete(key)
@@ -105,7 +159,8 @@ func (t *Txn) Do(reverse bool, from []byte, fn kvstore.Iteratee) error {
 	defer it.Close()
 
 	for it.Seek(from); it.Valid(); it.Next() {
-		err := fn(it.Item().Key())
+		// the key of the item will be reused, but the fn may keep it, such as to delete it
+		err := fn(it.Item().KeyCopy(nil))
 		if err == kvstore.ErrStop {
 			return nil
 		}
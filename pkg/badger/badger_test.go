@@ -3,12 +3,14 @@ package badger_test
 import (
 	"errors"
 	"testing"
+	"time"
 
 	originBadger "github.com/dgraph-io/badger/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/ysmood/kit"
 	"github.com/ysmood/storer/pkg/badger"
 	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/kvstore/kvtest"
 )
 
 func TestBasic(t *testing.T) {
@@ -84,6 +86,22 @@ func TestIteration(t *testing.T) {
 	})
 }
 
+func TestTTL(t *testing.T) {
+	db := badger.New("")
+
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		return txn.(kvstore.TTLTxn).SetWithTTL([]byte("k"), []byte("v"), time.Second)
+	}))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	_ = db.Do(false, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("k"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+		return nil
+	})
+}
+
 func TestErr(t *testing.T) {
 	db := badger.New("")
 
@@ -108,3 +126,10 @@ func TestErr(t *testing.T) {
 	})
 	assert.Equal(t, originBadger.ErrEmptyKey, err)
 }
+
+func TestSuite(t *testing.T) {
+	kvtest.Suite{
+		Open:     func() kvstore.Store { return badger.New("") },
+		Conflict: originBadger.ErrConflict,
+	}.Run(t)
+}
@@ -0,0 +1,334 @@
+package bbolt
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/ysmood/kit/pkg/utils"
+	"github.com/ysmood/storer/pkg/kvstore"
+	bolt "go.etcd.io/bbolt"
+)
+
+// the bucket to store all the keys, bbolt can't store keys outside of buckets
+var bucketName = []byte("storer")
+
+// ErrConflict the update transaction read a key or a key range that was changed by another transaction
+// committed after the read, the transaction is discarded, retry it if needed
+var ErrConflict = errors.New("[storer.bbolt] transaction conflict")
+
+// Bolt adapter for bbolt, it's suitable for the devices with little memory.
+// Keys can't be empty, the native TTL isn't supported, storer will track the expiry by itself.
+//
+// A read transaction is a bbolt read transaction, it reads from the snapshot when it begins.
+//
+// bbolt only allows one write transaction at a time, but storer may begin an update transaction
+// inside another one, such as to allocate ids or to create buckets. So the writes of an update
+// transaction are buffered and committed by one bbolt write transaction when the fn returns,
+// the reads are done by short bbolt read transactions. Before the commit, the values read via Get and
+// the key ranges fetched by the iteration are read again, if any of them has been changed, or a key
+// has been added to the ranges, ErrConflict will be returned. So the update transactions that commit
+// are serializable, the ones that don't write see the read committed level like Postgres.
+//
+// bbolt can't grow the mmap of the file while a read transaction is open, so an update transaction
+// committed inside a read transaction of the same goroutine will block forever if the file needs to grow
+// beyond the mmap. New maps 64MB at the beginning to avoid it, use bolt.Options.InitialMmapSize for NewByDB.
+type Bolt struct {
+	db *bolt.DB
+
+	// PrefetchSize by default each time 50 keys will be fetched during the iteration
+	PrefetchSize int
+}
+
+var _ kvstore.Store = &Bolt{}
+
+// New a helper to create a bbolt adapter instance.
+// If the path is empty a tmp file will be created.
+func New(path string) *Bolt {
+	if path == "" {
+		path = filepath.Join("tmp", utils.RandString(10)+".db")
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0775)
+	utils.E(err)
+
+	db, err := bolt.Open(path, 0664, &bolt.Options{
+		FreelistType:    bolt.FreelistArrayType,
+		InitialMmapSize: 64 << 20,
+	})
+	utils.E(err)
+
+	return NewByDB(db)
+}
+
+// NewByDB ...
+func NewByDB(db *bolt.DB) *Bolt {
+	return &Bolt{
+		db:           db,
+		PrefetchSize: 50,
+	}
+}
+
+// Do ...
+func (b *Bolt) Do(update bool, fn kvstore.DoTxn) error {
+	if !update {
+		return b.db.View(func(tx *bolt.Tx) error {
+			return fn(&Txn{bolt: b, tx: tx})
+		})
+	}
+
+	txn := &Txn{
+		bolt:   b,
+		reads:  map[string][]byte{},
+		writes: map[string][]byte{},
+	}
+
+	err := fn(txn)
+	if err != nil || len(txn.writes) == 0 {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+
+		for key, val := range txn.reads {
+			if !equal(bucket.Get([]byte(key)), val) {
+				return ErrConflict
+			}
+		}
+
+		for _, s := range txn.scans {
+			if !s.valid(bucket) {
+				return ErrConflict
+			}
+		}
+
+		for key, val := range txn.writes {
+			if val == nil {
+				err = bucket.Delete([]byte(key))
+			} else {
+				err = bucket.Put([]byte(key), val)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close ...
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// Txn ...
+type Txn struct {
+	bolt *Bolt
+
+	// tx the bbolt transaction of the read transaction, it's nil for the update transactions
+	tx *bolt.Tx
+
+	// reads the values read via Get, the nil value means the key doesn't exist,
+	// it's nil for the read transactions
+	reads map[string][]byte
+
+	// writes the buffered writes, the nil value means deletion, it's nil for the read transactions
+	writes map[string][]byte
+
+	// scans the batches fetched by the iteration of the update transaction
+	scans []*scan
+}
+
+var _ kvstore.Txn = &Txn{}
+
+// view the bucket is nil if nothing is written to the database yet, the read transaction uses its own
+// bbolt transaction, the update transaction uses a short one
+func (t *Txn) view(fn func(bucket *bolt.Bucket) error) error {
+	if t.tx != nil {
+		return fn(t.tx.Bucket(bucketName))
+	}
+	return t.bolt.db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(bucketName))
+	})
+}
+
+// Get ...
+func (t *Txn) Get(key []byte) ([]byte, error) {
+	if val, has := t.writes[string(key)]; has {
+		if val == nil {
+			return nil, kvstore.ErrKeyNotFound
+		}
+		return append([]byte{}, val...), nil
+	}
+
+	var value []byte
+	err := t.view(func(bucket *bolt.Bucket) error {
+		if bucket == nil {
+			return nil
+		}
+		// the value is only valid during the bbolt transaction
+		if v := bucket.Get(key); v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// only the first read matters
+	if _, has := t.reads[string(key)]; t.reads != nil && !has {
+		t.reads[string(key)] = value
+	}
+
+	if value == nil {
+		return nil, kvstore.ErrKeyNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Set the empty value will be stored as non-nil, or it can't be distinguished from the missing key
+func (t *Txn) Set(key, value []byte) error {
+	return t.set(key, append([]byte{}, value...))
+}
+
+// Delete ...
+func (t *Txn) Delete(key []byte) error {
+	return t.set(key, nil)
+}
+
+func (t *Txn) set(key, value []byte) error {
+	if t.writes == nil {
+		return bolt.ErrTxNotWritable
+	}
+	if len(key) == 0 {
+		return bolt.ErrKeyRequired
+	}
+	t.writes[string(key)] = value
+	return nil
+}
+
+// Do the reverse iteration begins with the last key less than or equal to the from,
+// if the from is nil it begins with the last key. The keys are fetched in batches, each batch
+// is merged with the writes of the transaction when it's fetched.
+func (t *Txn) Do(reverse bool, from []byte, fn kvstore.Iteratee) error {
+	return kvstore.Prefetch(t.bolt.PrefetchSize, t.writes, reverse, from, t.fetch, fn)
+}
+
+// fetch the next batch of keys after the from in the iteration order
+func (t *Txn) fetch(reverse bool, from []byte, inclusive bool) ([][]byte, error) {
+	var keys [][]byte
+
+	err := t.view(func(bucket *bolt.Bucket) error {
+		keys = collect(bucket, reverse, from, inclusive, func(_ []byte, n int) bool {
+			return n < t.bolt.PrefetchSize
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if t.writes != nil {
+		s := &scan{reverse: reverse, from: from, inclusive: inclusive, keys: keys}
+		// the batch that is not full covers the rest of the keys
+		if len(keys) == t.bolt.PrefetchSize {
+			s.last = keys[len(keys)-1]
+		}
+		t.scans = append(t.scans, s)
+	}
+	return keys, nil
+}
+
+// scan a key range fetched by the update transaction
+type scan struct {
+	reverse   bool
+	from      []byte
+	inclusive bool
+
+	// last the last key of the range, nil means no limit
+	last []byte
+
+	keys [][]byte
+}
+
+// valid checks the range still has the same keys
+func (s *scan) valid(bucket *bolt.Bucket) bool {
+	keys := collect(bucket, s.reverse, s.from, s.inclusive, func(key []byte, _ int) bool {
+		if s.last == nil {
+			return true
+		}
+		c := bytes.Compare(key, s.last)
+		if s.reverse {
+			return c >= 0
+		}
+		return c <= 0
+	})
+
+	if len(keys) != len(s.keys) {
+		return false
+	}
+	for i, key := range keys {
+		if !bytes.Equal(key, s.keys[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// collect the keys after the from in the iteration order while the more returns true,
+// the n is the number of the keys collected
+func collect(bucket *bolt.Bucket, reverse bool, from []byte, inclusive bool, more func(key []byte, n int) bool) [][]byte {
+	keys := [][]byte{}
+	if bucket == nil {
+		return keys
+	}
+	c := bucket.Cursor()
+
+	key := seek(c, reverse, from, inclusive)
+	for key != nil && more(key, len(keys)) {
+		// the key is only valid during the bbolt transaction
+		keys = append(keys, append([]byte{}, key...))
+		if reverse {
+			key, _ = c.Prev()
+		} else {
+			key, _ = c.Next()
+		}
+	}
+	return keys
+}
+
+// equal compare the value in the bbolt with the value read, the empty value in the bbolt is non-nil
+func equal(value, read []byte) bool {
+	return (value == nil) == (read == nil) && bytes.Equal(value, read)
+}
+
+func seek(c *bolt.Cursor, reverse bool, from []byte, inclusive bool) []byte {
+	if !reverse {
+		key, _ := c.Seek(from)
+		if key != nil && !inclusive && bytes.Equal(key, from) {
+			key, _ = c.Next()
+		}
+		return key
+	}
+
+	if from == nil {
+		key, _ := c.Last()
+		return key
+	}
+
+	key, _ := c.Seek(from)
+	if key == nil {
+		key, _ = c.Last()
+		return key
+	}
+	if !inclusive || !bytes.Equal(key, from) {
+		key, _ = c.Prev()
+	}
+	return key
+}
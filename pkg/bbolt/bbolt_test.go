@@ -0,0 +1,166 @@
+package bbolt_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer/pkg/bbolt"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/kvstore/kvtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestPrefetch(t *testing.T) {
+	db := bbolt.New("")
+	db.PrefetchSize = 3
+
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		for i := 0; i < 10; i += 2 {
+			err := txn.Set([]byte(fmt.Sprint(i)), nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	keys := func(txn kvstore.Txn, reverse bool, from []byte) string {
+		s := ""
+		kit.E(txn.Do(reverse, from, func(key []byte) error {
+			s += string(key)
+			return nil
+		}))
+		return s
+	}
+
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Set([]byte("3"), nil))
+		kit.E(txn.Set([]byte("9"), nil))
+		kit.E(txn.Delete([]byte("4")))
+
+		assert.Equal(t, "023689", keys(txn, false, nil))
+		assert.Equal(t, "3689", keys(txn, false, []byte("3")))
+		assert.Equal(t, "986320", keys(txn, true, nil))
+		assert.Equal(t, "320", keys(txn, true, []byte("4")))
+
+		// the writes are invisible to others until committed
+		return db.Do(false, func(other kvstore.Txn) error {
+			assert.Equal(t, "02468", keys(other, false, nil))
+			return nil
+		})
+	}))
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		assert.Equal(t, "023689", keys(txn, false, nil))
+		return nil
+	}))
+}
+
+func TestBoltErr(t *testing.T) {
+	db := bbolt.New("")
+
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		return txn.Set(nil, nil)
+	})
+	assert.Equal(t, bolt.ErrKeyRequired, err)
+
+	err = db.Do(false, func(txn kvstore.Txn) error {
+		return txn.Set([]byte("k"), nil)
+	})
+	assert.Equal(t, bolt.ErrTxNotWritable, err)
+}
+
+func TestConflict(t *testing.T) {
+	db := bbolt.New("")
+	set := func(key, value string) {
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			return txn.Set([]byte(key), []byte(value))
+		}))
+	}
+	set("a", "1")
+
+	// the writes of others to the keys not read don't conflict
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("a"))
+		kit.E(err)
+
+		set("b", "2")
+
+		return txn.Set([]byte("a"), []byte("3"))
+	}))
+
+	// the missing key read is set by others
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("c"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+
+		set("c", "")
+
+		return txn.Set([]byte("c"), []byte("4"))
+	})
+	assert.Equal(t, bbolt.ErrConflict, err)
+
+	// the read transaction reads from the snapshot
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		set("d", "5")
+
+		_, err := txn.Get([]byte("d"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+		return nil
+	}))
+
+	kit.E(db.Close())
+}
+
+func TestConflictIteration(t *testing.T) {
+	db := bbolt.New("")
+	db.PrefetchSize = 2
+	set := func(key string) {
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			return txn.Set([]byte(key), nil)
+		}))
+	}
+	set("a")
+	set("c")
+	set("e")
+
+	// iterate the first batch only, then others write in and out of the range
+	iterate := func(write string) error {
+		return db.Do(true, func(txn kvstore.Txn) error {
+			kit.E(txn.Do(false, nil, func(key []byte) error {
+				if string(key) == "c" {
+					return kvstore.ErrStop
+				}
+				return nil
+			}))
+
+			set(write)
+
+			return txn.Set([]byte("x"), nil)
+		})
+	}
+
+	kit.E(iterate("d"))
+	assert.Equal(t, bbolt.ErrConflict, iterate("b"))
+
+	// the key deleted by others
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Do(true, []byte("b"), func([]byte) error { return nil }))
+
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			return txn.Delete([]byte("a"))
+		}))
+
+		return txn.Set([]byte("x"), nil)
+	})
+	assert.Equal(t, bbolt.ErrConflict, err)
+}
+
+func TestSuite(t *testing.T) {
+	kvtest.Suite{
+		Open:     func() kvstore.Store { return bbolt.New("") },
+		Conflict: bbolt.ErrConflict,
+	}.Run(t)
+}
@@ -14,6 +14,9 @@ var nameMapPrefix = byframe.EncodeHeader(0)
 // ErrKeyNotFound ...
 var ErrKeyNotFound = kvstore.ErrKeyNotFound
 
+// ErrBucketExists ...
+var ErrBucketExists = errors.New("[storer.bucket] bucket already exists")
+
 // ErrEmptyName ...
 var ErrEmptyName = errors.New("[storer.bucket] name cannot be empty")
 
@@ -68,11 +71,165 @@ func New(txn Txn, name []byte) (*Bucket, error) {
 	return &Bucket{countData}, nil
 }
 
+// Lookup get the bucket via the name without creating it, if the bucket doesn't exist
+// ErrKeyNotFound will be returned
+func Lookup(txn Txn, name []byte) (*Bucket, error) {
+	prefix, err := txn.Get(append(nameMapPrefix, name...))
+	if err != nil {
+		return nil, err
+	}
+	return &Bucket{prefix}, nil
+}
+
 // Delete delete bucket from the db
 func Delete(txn Txn, name string) error {
 	return txn.Delete(append(nameMapPrefix, name...))
 }
 
+// Rename remap the name of the bucket to a new name, the prefix and the data of the bucket
+// won't change. If the new name is already used ErrBucketExists will be returned.
+func Rename(txn Txn, from, to []byte) error {
+	if len(to) == 0 {
+		return ErrEmptyName
+	}
+
+	b, err := Lookup(txn, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = Lookup(txn, to)
+	if err == nil {
+		return ErrBucketExists
+	} else if err != ErrKeyNotFound {
+		return err
+	}
+
+	err = txn.Set(append(nameMapPrefix, to...), b.prefix)
+	if err != nil {
+		return err
+	}
+
+	return Delete(txn, string(from))
+}
+
+// Info the information of a named bucket
+type Info struct {
+	// Name ...
+	Name []byte
+	// Prefix ...
+	Prefix []byte
+	// Count the number of keys in the bucket
+	Count int
+}
+
+// Names list the names of all the buckets in byte-wise order
+func Names(txn Txn) ([][]byte, error) {
+	names := [][]byte{}
+
+	err := txn.Do(false, nameMapPrefix, func(key []byte) error {
+		if !bytes.HasPrefix(key, nameMapPrefix) {
+			return kvstore.ErrStop
+		}
+
+		// the counter of the name map
+		if len(key) == len(nameMapPrefix) {
+			return nil
+		}
+
+		name := make([]byte, len(key)-len(nameMapPrefix))
+		copy(name, key[len(nameMapPrefix):])
+		names = append(names, name)
+		return nil
+	})
+	return names, err
+}
+
+// List all the named buckets, the keys of each bucket will be iterated to count them.
+func List(txn Txn) ([]*Info, error) {
+	names, err := Names(txn)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []*Info{}
+	for _, name := range names {
+		info := &Info{Name: name}
+		list = append(list, info)
+
+		b, err := Lookup(txn, info.Name)
+		if err != nil {
+			return nil, err
+		}
+		info.Prefix = b.prefix
+
+		info.Count, err = b.Count(txn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+// Drop remove the bucket and all its data. The data will be removed in batches, each batch uses its own
+// transaction, so that a large bucket won't exceed the transaction size limit of the backend.
+// The name is removed at last, if the drop is interrupted, drop it again to remove the rest.
+// If the batch is not positive, 1000 will be used.
+func Drop(db kvstore.Store, name []byte, batch int) error {
+	if batch <= 0 {
+		batch = 1000
+	}
+
+	var b *Bucket
+	err := db.Do(false, func(txn Txn) error {
+		var err error
+		b, err = Lookup(txn, name)
+		return err
+	})
+	if err == ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for {
+		count := 0
+		err := db.Do(true, func(txn Txn) error {
+			keys := [][]byte{}
+			err := txn.Do(false, b.prefix, func(key []byte) error {
+				if !b.Valid(key) || len(keys) == batch {
+					return kvstore.ErrStop
+				}
+				keys = append(keys, append([]byte{}, key...))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, key := range keys {
+				err = txn.Delete(key)
+				if err != nil {
+					return err
+				}
+			}
+			count = len(keys)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if count < batch {
+			break
+		}
+	}
+
+	return db.Do(true, func(txn Txn) error {
+		return Delete(txn, string(name))
+	})
+}
+
 // Set set key and value to the store with prefix
 func (b *Bucket) Set(txn Txn, key, value []byte) error {
 	return txn.Set(b.Prefix(key), value)
@@ -88,9 +245,24 @@ func (b *Bucket) Delete(txn Txn, key []byte) error {
 	return txn.Delete(b.Prefix(key))
 }
 
-// Prefix prefix key
+// Prefix prefix key, the returned slice never shares memory with other prefixed keys
 func (b *Bucket) Prefix(key []byte) []byte {
-	return append(b.prefix, key...)
+	l := len(b.prefix)
+	return append(b.prefix[:l:l], key...)
+}
+
+// PrefixOf get the bucket prefix of a key, if the key isn't prefixed by a bucket the whole key is returned
+func PrefixOf(key []byte) []byte {
+	_, l, sufficient := byframe.DecodeHeader(key)
+	if !sufficient {
+		return key
+	}
+	return key[:l]
+}
+
+// InNameMap check if the key belongs to the name map, which maps the names to the prefixes of the buckets
+func InNameMap(key []byte) bool {
+	return bytes.Equal(PrefixOf(key), nameMapPrefix)
 }
 
 // Len length of the prefix
@@ -107,6 +279,19 @@ func (b *Bucket) Valid(prefixedKey []byte) bool {
 	return bytes.Equal(b.prefix, prefixedKey[:l])
 }
 
+// Count the number of keys in the bucket
+func (b *Bucket) Count(txn Txn) (int, error) {
+	count := 0
+	err := txn.Do(false, b.prefix, func(key []byte) error {
+		if !b.Valid(key) {
+			return kvstore.ErrStop
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
 // Empty remove everything in the bucket.
 func (b *Bucket) Empty(txn Txn) error {
 	return txn.Do(false, b.prefix, func(key []byte) error {
@@ -24,6 +24,9 @@ func TestBasic(t *testing.T) {
 
 		assert.Equal(t, 1, b.Len())
 
+		assert.True(t, bucket.InNameMap(append([]byte{0}, "test"...)))
+		assert.False(t, bucket.InNameMap(b.Prefix([]byte("key"))))
+
 		return nil
 	})
 
@@ -82,6 +85,124 @@ func TestDrop(t *testing.T) {
 	})
 }
 
+func TestListAndDrop(t *testing.T) {
+	db := badger.New("")
+
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		a, _ := bucket.New(txn, []byte("a"))
+		b, _ := bucket.New(txn, []byte("b"))
+
+		for i := 0; i < 10; i++ {
+			_ = a.Set(txn, []byte{byte(i)}, nil)
+		}
+		_ = b.Set(txn, []byte("k"), []byte("b"))
+		return nil
+	}))
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		list, err := bucket.List(txn)
+		kit.E(err)
+		assert.Equal(t, []*bucket.Info{
+			{Name: []byte("a"), Prefix: []byte{1}, Count: 10},
+			{Name: []byte("b"), Prefix: []byte{2}, Count: 1},
+		}, list)
+
+		_, err = bucket.Lookup(txn, []byte("c"))
+		assert.Equal(t, bucket.ErrKeyNotFound, err)
+		return nil
+	}))
+
+	kit.E(bucket.Drop(db, []byte("a"), 3))
+	kit.E(bucket.Drop(db, []byte("c"), 0))
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		list, err := bucket.List(txn)
+		kit.E(err)
+		assert.Equal(t, []*bucket.Info{
+			{Name: []byte("b"), Prefix: []byte{2}, Count: 1},
+		}, list)
+
+		_, err = bucket.Lookup(txn, []byte("a"))
+		assert.Equal(t, bucket.ErrKeyNotFound, err)
+
+		// name map counter, name of b, data of b
+		n := 0
+		_ = txn.Do(false, nil, func(_ []byte) error {
+			n++
+			return nil
+		})
+		assert.Equal(t, 3, n)
+		return nil
+	}))
+}
+
+func TestRename(t *testing.T) {
+	db := badger.New("")
+
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		a, _ := bucket.New(txn, []byte("a"))
+		_, _ = bucket.New(txn, []byte("b"))
+		_ = a.Set(txn, []byte("k"), []byte("v"))
+
+		assert.Equal(t, bucket.ErrBucketExists, bucket.Rename(txn, []byte("a"), []byte("b")))
+		assert.Equal(t, bucket.ErrKeyNotFound, bucket.Rename(txn, []byte("x"), []byte("y")))
+		assert.Equal(t, bucket.ErrEmptyName, bucket.Rename(txn, []byte("a"), nil))
+
+		kit.E(bucket.Rename(txn, []byte("a"), []byte("c")))
+
+		_, err := bucket.Lookup(txn, []byte("a"))
+		assert.Equal(t, bucket.ErrKeyNotFound, err)
+
+		c, _ := bucket.Lookup(txn, []byte("c"))
+		v, _ := c.Get(txn, []byte("k"))
+		assert.Equal(t, []byte("v"), v)
+		return nil
+	}))
+
+	_ = db.Do(true, func(txn kvstore.Txn) error {
+		err := bucket.Rename(&ErrTxn{Txn: txn, errs: []error{nil, errTxn}}, []byte("b"), []byte("d"))
+		assert.Equal(t, errTxn, err)
+		err = bucket.Rename(&ErrTxn{Txn: txn, errs: []error{nil, bucket.ErrKeyNotFound, errTxn}}, []byte("b"), []byte("d"))
+		assert.Equal(t, errTxn, err)
+		return nil
+	})
+}
+
+type ErrStore struct {
+	db   kvstore.Store
+	errs []error
+}
+
+func (s *ErrStore) Do(update bool, fn kvstore.DoTxn) error {
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	return s.db.Do(update, fn)
+}
+
+func TestDropErr(t *testing.T) {
+	db := badger.New("")
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		b, _ := bucket.New(txn, []byte("a"))
+		return b.Set(txn, []byte("k"), nil)
+	}))
+
+	assert.Equal(t, errTxn, bucket.Drop(&ErrStore{db, []error{errTxn}}, []byte("a"), 1))
+	assert.Equal(t, errTxn, bucket.Drop(&ErrStore{db, []error{nil, errTxn}}, []byte("a"), 1))
+
+	list := []error{}
+	_ = db.Do(false, func(txn kvstore.Txn) error {
+		_, err := bucket.List(&ErrTxn{Txn: txn, errs: []error{errTxn}})
+		list = append(list, err)
+		return nil
+	})
+	assert.Equal(t, []error{errTxn}, list)
+}
+
 type ErrTxn struct {
 	bucket.Txn
 	count int
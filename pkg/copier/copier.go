@@ -0,0 +1,228 @@
+// Package copier moves the data from one kvstore.Store to another, such as from badger to Postgres.
+//
+// The keys are copied in chunks, each chunk is a read transaction on the source and a write transaction on the
+// target, so it won't exceed the transaction size limit of the backends. The copy can be resumed from the last
+// copied key after an interruption. Because the chunks are not a single snapshot, wrap the source with a Mirror
+// to keep the writes during the copy in sync, then verify the two stores before the cutover.
+package copier
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// the default max number of keys to copy in a single transaction
+const defaultBatch = 1000
+
+// ErrMismatch ...
+var ErrMismatch = errors.New("[storer.copier] the target doesn't match the source")
+
+// Copier copy all the keys from a store to another
+type Copier struct {
+	// Batch the max number of keys to copy in a single transaction
+	Batch int
+
+	// Last the last copied key, the copy will continue after it.
+	// Persist it in OnChunk to resume the copy after an interruption.
+	Last []byte
+
+	// Copied the number of keys copied by this copier
+	Copied int
+
+	// OnChunk is called after each chunk is committed to the target,
+	// if it returns error the copy will stop with the error
+	OnChunk func(last []byte) error
+
+	from kvstore.Store
+	to   kvstore.Store
+}
+
+// New if the from is a Mirror, the chunks will be copied from the primary of it, the keys written via the
+// mirror during a chunk will be skipped, so that a stale chunk never overwrites a newer mirrored write.
+// Only one copier should copy from the same mirror at a time.
+func New(from, to kvstore.Store) *Copier {
+	return &Copier{
+		Batch: defaultBatch,
+		from:  from,
+		to:    to,
+	}
+}
+
+// Copy the keys after the Last key. The native TTLs of the source are not copied, the records of storer
+// keep their own expiry, so they are still treated as expired after the copy.
+func (c *Copier) Copy() error {
+	for {
+		n, err := c.chunk()
+		if err != nil || n == 0 {
+			return err
+		}
+
+		// outside of the chunk, so that it can write to the mirror
+		if c.OnChunk != nil {
+			err = c.OnChunk(c.Last)
+			if err != nil {
+				return err
+			}
+		}
+
+		if n < c.Batch {
+			return nil
+		}
+	}
+}
+
+// copy a chunk of keys, returns the number of the read keys
+func (c *Copier) chunk() (int, error) {
+	from := c.from
+	m, isMirror := from.(*Mirror)
+	if isMirror {
+		from = m.primary
+		m.track()
+	}
+
+	keys, values, err := c.read(from)
+	if err != nil || len(keys) == 0 {
+		if isMirror {
+			m.untrack()
+		}
+		return 0, err
+	}
+
+	var dirty map[string]bool
+	if isMirror {
+		// the mirror can't apply its changes to the target during the write
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		dirty = m.dirty
+		m.dirty = nil
+	}
+
+	err = c.to.Do(true, func(txn kvstore.Txn) error {
+		for i, key := range keys {
+			if dirty[string(key)] {
+				continue
+			}
+			err := txn.Set(key, values[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.Last = keys[len(keys)-1]
+	c.Copied += len(keys)
+
+	return len(keys), nil
+}
+
+// read a chunk of keys after the Last key
+func (c *Copier) read(from kvstore.Store) (keys, values [][]byte, err error) {
+	var start []byte
+	if c.Last != nil {
+		start = append(append([]byte{}, c.Last...), 0)
+	}
+
+	err = from.Do(false, func(txn kvstore.Txn) error {
+		return txn.Do(false, start, func(key []byte) error {
+			if len(keys) >= c.Batch {
+				return kvstore.ErrStop
+			}
+
+			value, err := txn.Get(key)
+			if err == kvstore.ErrKeyNotFound {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			keys = append(keys, append([]byte{}, key...))
+			values = append(values, value)
+			return nil
+		})
+	})
+	return
+}
+
+// Summary the count and checksum of all the keys of a store
+type Summary struct {
+	Count    int
+	Checksum []byte
+}
+
+// Equal ...
+func (s *Summary) Equal(other *Summary) bool {
+	return s.Count == other.Count && bytes.Equal(s.Checksum, other.Checksum)
+}
+
+func (s *Summary) String() string {
+	return fmt.Sprintf("%d keys, checksum %x", s.Count, s.Checksum)
+}
+
+// Sum get the summary of the store in a single read transaction
+func Sum(db kvstore.Store) (*Summary, error) {
+	s := &Summary{}
+	h := sha256.New()
+
+	err := db.Do(false, func(txn kvstore.Txn) error {
+		return txn.Do(false, nil, func(key []byte) error {
+			value, err := txn.Get(key)
+			if err == kvstore.ErrKeyNotFound {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			s.Count++
+			write(h, key)
+			write(h, value)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Checksum = h.Sum(nil)
+	return s, nil
+}
+
+// the length prefix makes the boundaries of the keys and values unambiguous
+func write(h hash.Hash, b []byte) {
+	l := make([]byte, binary.MaxVarintLen64)
+	_, _ = h.Write(l[:binary.PutUvarint(l, uint64(len(b)))])
+	_, _ = h.Write(b)
+}
+
+// Verify compare the counts and checksums of the source and target, returns ErrMismatch if they are different.
+// Pause the writes to the source before the verification, or the result may be stale.
+func (c *Copier) Verify() (from, to *Summary, err error) {
+	src := c.from
+	if m, ok := src.(*Mirror); ok {
+		src = m.primary
+	}
+
+	from, err = Sum(src)
+	if err != nil {
+		return
+	}
+
+	to, err = Sum(c.to)
+	if err != nil {
+		return
+	}
+
+	if !from.Equal(to) {
+		err = ErrMismatch
+	}
+	return
+}
@@ -0,0 +1,128 @@
+package copier_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/copier"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/memory"
+)
+
+func set(db kvstore.Store, kvs ...string) {
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		for i := 0; i < len(kvs); i += 2 {
+			err := txn.Set([]byte(kvs[i]), []byte(kvs[i+1]))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func TestCopy(t *testing.T) {
+	from := memory.New()
+	for i := 0; i < 250; i++ {
+		set(from, fmt.Sprintf("%03d", i), fmt.Sprint(i))
+	}
+	to := memory.New()
+
+	c := copier.New(from, to)
+	c.Batch = 100
+	chunks := 0
+	c.OnChunk = func(last []byte) error {
+		chunks++
+		return nil
+	}
+
+	kit.E(c.Copy())
+	assert.Equal(t, 3, chunks)
+	assert.Equal(t, 250, c.Copied)
+	assert.Equal(t, "249", string(c.Last))
+
+	src, dst, err := c.Verify()
+	kit.E(err)
+	assert.Equal(t, 250, src.Count)
+	assert.Equal(t, src.String(), dst.String())
+
+	set(to, "000", "x")
+	_, _, err = c.Verify()
+	assert.Equal(t, copier.ErrMismatch, err)
+}
+
+func TestResume(t *testing.T) {
+	from := memory.New()
+	for i := 0; i < 30; i++ {
+		set(from, fmt.Sprintf("%02d", i), fmt.Sprint(i))
+	}
+	to := memory.New()
+
+	errInterrupted := errors.New("interrupted")
+
+	c := copier.New(from, to)
+	c.Batch = 10
+	c.OnChunk = func(last []byte) error {
+		return errInterrupted
+	}
+	assert.Equal(t, errInterrupted, c.Copy())
+	assert.Equal(t, "09", string(c.Last))
+
+	resumed := copier.New(from, to)
+	resumed.Last = c.Last
+	kit.E(resumed.Copy())
+	assert.Equal(t, 20, resumed.Copied)
+
+	_, _, err := resumed.Verify()
+	kit.E(err)
+}
+
+type Item struct {
+	Name string
+}
+
+func TestMirror(t *testing.T) {
+	from := memory.New()
+	to := memory.New()
+
+	mirror := copier.NewMirror(from, to)
+	store := storer.NewWithDB("", mirror)
+	list := store.List(&Item{})
+	index := list.Index("name", func(item *Item) interface{} {
+		return item.Name
+	})
+
+	for i := 0; i < 20; i++ {
+		_, _ = list.Add(&Item{fmt.Sprint(i)})
+	}
+
+	c := copier.New(mirror, to)
+	c.Batch = 10
+	c.OnChunk = func(last []byte) error {
+		// the writes during the copy
+		id, err := list.Add(&Item{"new"})
+		if err != nil {
+			return err
+		}
+		return list.Del(id)
+	}
+	kit.E(c.Copy())
+
+	_, _ = list.Add(&Item{"after"})
+
+	_, _, err := c.Verify()
+	kit.E(err)
+
+	var item Item
+	target := storer.NewWithDB("", to).List(&Item{})
+	kit.E(target.Index("name", func(item *Item) interface{} {
+		return item.Name
+	}).From("after").Find(&item))
+	assert.Equal(t, "after", item.Name)
+
+	kit.E(index.From("after").Find(&item))
+}
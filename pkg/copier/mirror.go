@@ -0,0 +1,168 @@
+package copier
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// Mirror a store that replicates the writes of the primary to the secondary, use it as the database
+// during the cutover, so that the writes after a chunk is copied won't be lost.
+// The reads only go to the primary.
+type Mirror struct {
+	primary   kvstore.Store
+	secondary kvstore.Store
+
+	// lock serializes the applying to the secondary and the writing of the copier
+	lock sync.Mutex
+
+	// dirty the keys written after the copier begins to read a chunk, nil if no chunk is being copied
+	dirty map[string]bool
+}
+
+var _ kvstore.Store = &Mirror{}
+
+// NewMirror ...
+func NewMirror(primary, secondary kvstore.Store) *Mirror {
+	return &Mirror{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// Close close the primary and secondary if they can be closed
+func (m *Mirror) Close() error {
+	for _, db := range []kvstore.Store{m.primary, m.secondary} {
+		if c, ok := db.(io.Closer); ok {
+			err := c.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Do the changes are applied to the secondary in a transaction after the primary commits.
+// If the secondary fails the error will be returned but the primary won't be rolled back,
+// copy the keys again and verify them before the cutover.
+func (m *Mirror) Do(update bool, fn kvstore.DoTxn) error {
+	if !update {
+		return m.primary.Do(false, fn)
+	}
+
+	var ops []*op
+	err := m.primary.Do(true, func(txn kvstore.Txn) error {
+		ops = nil
+		mt := &mirrorTxn{Txn: txn, ops: &ops}
+
+		if _, ok := txn.(kvstore.TTLTxn); ok {
+			return fn(&mirrorTTLTxn{mt})
+		}
+		return fn(mt)
+	})
+	if err != nil || len(ops) == 0 {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.dirty != nil {
+		for _, o := range ops {
+			m.dirty[string(o.key)] = true
+		}
+	}
+
+	return m.secondary.Do(true, func(txn kvstore.Txn) error {
+		for _, o := range ops {
+			err := o.apply(txn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Mirror) track() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.dirty = map[string]bool{}
+}
+
+func (m *Mirror) untrack() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.dirty = nil
+}
+
+// op a write to replicate
+type op struct {
+	key     []byte
+	value   []byte
+	ttl     time.Duration
+	deleted bool
+}
+
+func (o *op) apply(txn kvstore.Txn) error {
+	if o.deleted {
+		return txn.Delete(o.key)
+	}
+
+	if o.ttl > 0 {
+		if ttlTxn, ok := txn.(kvstore.TTLTxn); ok {
+			return ttlTxn.SetWithTTL(o.key, o.value, o.ttl)
+		}
+	}
+	return txn.Set(o.key, o.value)
+}
+
+type mirrorTxn struct {
+	kvstore.Txn
+	ops *[]*op
+}
+
+// Set ...
+func (txn *mirrorTxn) Set(key, value []byte) error {
+	err := txn.Txn.Set(key, value)
+	if err != nil {
+		return err
+	}
+	txn.record(&op{key: key, value: value})
+	return nil
+}
+
+// Delete ...
+func (txn *mirrorTxn) Delete(key []byte) error {
+	err := txn.Txn.Delete(key)
+	if err != nil {
+		return err
+	}
+	txn.record(&op{key: key, deleted: true})
+	return nil
+}
+
+// the key and value may be reused by the caller after the call
+func (txn *mirrorTxn) record(o *op) {
+	o.key = append([]byte{}, o.key...)
+	o.value = append([]byte{}, o.value...)
+	*txn.ops = append(*txn.ops, o)
+}
+
+// mirrorTTLTxn is used when the primary supports native TTL
+type mirrorTTLTxn struct {
+	*mirrorTxn
+}
+
+// SetWithTTL ...
+func (txn *mirrorTTLTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	err := txn.Txn.(kvstore.TTLTxn).SetWithTTL(key, value, ttl)
+	if err != nil {
+		return err
+	}
+	txn.record(&op{key: key, value: value, ttl: ttl})
+	return nil
+}
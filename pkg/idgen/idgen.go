@@ -0,0 +1,148 @@
+// Package idgen provides time-sortable id generators.
+// The ids generated by the same process are strictly increasing, so the byte-wise
+// order of them is the same as the order of creation.
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// KSUIDEpoch the epoch of KSUID, 2014-05-13
+const KSUIDEpoch = 1400000000
+
+var lock = sync.Mutex{}
+
+// the state of each generator
+var (
+	lastULID   = make([]byte, 16)
+	lastKSUID  = make([]byte, 20)
+	lastUUIDv7 = make([]byte, 16)
+)
+
+// ULID generate a 16 bytes ULID, the first 6 bytes are the unix milliseconds,
+// the rest 10 bytes are random. When the timestamp is the same as the last id
+// the random part will be increased by one.
+func ULID() []byte {
+	lock.Lock()
+	defer lock.Unlock()
+
+	id := make([]byte, 16)
+	putMillis(id, time.Now())
+
+	if string(id[:6]) <= string(lastULID[:6]) {
+		copy(id, lastULID)
+		increase(id)
+	} else {
+		randBytes(id[6:])
+	}
+
+	copy(lastULID, id)
+	return id
+}
+
+// ULIDPrefix the prefix of the ULIDs generated at the time t, use it for time-range scans
+func ULIDPrefix(t time.Time) []byte {
+	id := make([]byte, 6)
+	putMillis(id, t)
+	return id
+}
+
+// KSUID generate a 20 bytes KSUID-like id, the first 4 bytes are the seconds since KSUIDEpoch,
+// the rest 16 bytes are random. When the timestamp is the same as the last id
+// the random part will be increased by one.
+func KSUID() []byte {
+	lock.Lock()
+	defer lock.Unlock()
+
+	id := KSUIDPrefix(time.Now())
+	id = append(id, make([]byte, 16)...)
+
+	if string(id[:4]) <= string(lastKSUID[:4]) {
+		copy(id, lastKSUID)
+		increase(id)
+	} else {
+		randBytes(id[4:])
+	}
+
+	copy(lastKSUID, id)
+	return id
+}
+
+// KSUIDPrefix the prefix of the KSUIDs generated at the time t, use it for time-range scans
+func KSUIDPrefix(t time.Time) []byte {
+	id := make([]byte, 4)
+	binary.BigEndian.PutUint32(id, uint32(t.Unix()-KSUIDEpoch))
+	return id
+}
+
+// UUIDv7 generate a 16 bytes UUID version 7 (RFC 9562). The 12 bits rand_a field is used as
+// a counter for the ids generated in the same millisecond, when the counter overflows the
+// timestamp will be increased by one.
+func UUIDv7() []byte {
+	lock.Lock()
+	defer lock.Unlock()
+
+	id := make([]byte, 16)
+	putMillis(id, time.Now())
+	randBytes(id[6:])
+
+	last := lastUUIDv7
+	if string(id[:6]) <= string(last[:6]) {
+		copy(id[:6], last[:6])
+		counter := binary.BigEndian.Uint16(last[6:8])&0x0fff + 1
+		if counter > 0x0fff {
+			increase(id[:6])
+			counter = 0
+		}
+		binary.BigEndian.PutUint16(id[6:8], counter)
+	} else {
+		// leave half of the counter space for the ids in the same millisecond
+		id[6] &= 0x07
+	}
+
+	id[6] = id[6]&0x0f | 0x70 // version 7
+	id[8] = id[8]&0x3f | 0x80 // variant 10
+
+	copy(lastUUIDv7, id)
+	return id
+}
+
+// UUIDv7Prefix the prefix of the UUIDv7s generated at the time t, use it for time-range scans
+func UUIDv7Prefix(t time.Time) []byte {
+	return ULIDPrefix(t)
+}
+
+// Sequence encode a sequence number to a big-endian id, so that the byte-wise order
+// is the same as the number order
+func Sequence(n uint64) []byte {
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, n)
+	return id
+}
+
+func putMillis(id []byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+}
+
+// increase the id by one as a big-endian number
+func increase(id []byte) {
+	for i := len(id) - 1; i >= 0; i-- {
+		id[i]++
+		if id[i] != 0 {
+			return
+		}
+	}
+}
+
+func randBytes(b []byte) {
+	_, _ = rand.Read(b)
+}
@@ -0,0 +1,56 @@
+package idgen_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/storer/pkg/idgen"
+)
+
+func assertIncreasing(t *testing.T, gen func() []byte, size int) {
+	last := gen()
+	assert.Len(t, last, size)
+
+	for i := 0; i < 10000; i++ {
+		id := gen()
+		assert.Len(t, id, size)
+		if bytes.Compare(last, id) >= 0 {
+			t.Fatalf("%x should be greater than %x", id, last)
+		}
+		last = id
+	}
+}
+
+func TestULID(t *testing.T) {
+	assertIncreasing(t, idgen.ULID, 16)
+
+	start := idgen.ULIDPrefix(time.Now())
+	id := idgen.ULID()
+	end := idgen.ULIDPrefix(time.Now().Add(time.Millisecond))
+	assert.True(t, bytes.Compare(start, id) <= 0)
+	assert.True(t, bytes.Compare(id, end) < 0)
+}
+
+func TestKSUID(t *testing.T) {
+	assertIncreasing(t, idgen.KSUID, 20)
+
+	start := idgen.KSUIDPrefix(time.Now())
+	id := idgen.KSUID()
+	assert.True(t, bytes.Compare(start, id) <= 0)
+	assert.Equal(t, []byte{0, 0, 0, 0}, idgen.KSUIDPrefix(time.Unix(idgen.KSUIDEpoch, 0)))
+}
+
+func TestUUIDv7(t *testing.T) {
+	assertIncreasing(t, idgen.UUIDv7, 16)
+
+	id := idgen.UUIDv7()
+	assert.Equal(t, byte(0x70), id[6]&0xf0)
+	assert.Equal(t, byte(0x80), id[8]&0xc0)
+	assert.True(t, bytes.Compare(idgen.UUIDv7Prefix(time.Now().Add(-time.Second)), id) < 0)
+}
+
+func TestSequence(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 1, 0}, idgen.Sequence(256))
+}
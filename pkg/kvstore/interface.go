@@ -1,6 +1,9 @@
 package kvstore
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // The minimum interface to create an efficient indexable database with a key-value store.
 // When any reduction of the interface design will dramatically impact the performance we can say the
@@ -44,3 +47,48 @@ var ErrStop = errors.New("[storer.kvstore] stop iteration")
 
 // Iteratee ...
 type Iteratee func(key []byte) error
+
+// TTLTxn optional interface for the backends that can expire keys natively.
+// If a Txn doesn't implement it, storer will track the expiry by itself.
+type TTLTxn interface {
+	Txn
+
+	// SetWithTTL set item with key and value, the item will be removed after the ttl
+	SetWithTTL(key, value []byte, ttl time.Duration) error
+}
+
+// Change the latest change of a key
+type Change struct {
+	Key []byte
+
+	// Value is nil if the key is deleted
+	Value []byte
+
+	// Deleted ...
+	Deleted bool
+
+	// ExpiresAt the unix time in seconds when the key expires, zero means never
+	ExpiresAt uint64
+}
+
+// Versioned optional interface for the backends that can iterate the changes after a version,
+// it's used by the incremental backup
+type Versioned interface {
+	Store
+
+	// Changes iterate the latest changes of the keys committed after the since version in a
+	// consistent snapshot, the order is the same as Txn.Do. The deleted keys are only included
+	// when since is not zero. Returns the version of the snapshot.
+	Changes(since uint64, fn func(change *Change) error) (uint64, error)
+}
+
+// Notifier optional interface for the backends that can notify the changes committed by the update transactions,
+// if the database is shared by multiple processes the changes of all the processes should be notified
+type Notifier interface {
+	Store
+
+	// Notify call the fn with the distinct key prefixes changed by each committed update transaction until
+	// the stop is called. The prefixes are nil if any key may have changed, such as the notifications
+	// are lost during a reconnection.
+	Notify(fn func(prefixes [][]byte)) (stop func() error, err error)
+}
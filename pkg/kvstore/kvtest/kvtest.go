@@ -0,0 +1,350 @@
+// Package kvtest is the conformance test suite for the kvstore.Store implementations.
+//
+// Use it in the test of an adapter:
+//
+//	func TestSuite(t *testing.T) {
+//		kvtest.Suite{
+//			Open:     func() kvstore.Store { return adapter.New("") },
+//			Conflict: adapter.ErrConflict,
+//		}.Run(t)
+//	}
+package kvtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// Suite the behaviors that are allowed to be different between the adapters
+type Suite struct {
+	// Open returns an empty store for each test, the store will be closed if it's an io.Closer
+	Open func() kvstore.Store
+
+	// Conflict the error returned by an update transaction when a key it read is committed by another
+	// transaction after it began, it's required, because storer relies on it, such as CompareAndSwap
+	// and Sequence
+	Conflict error
+
+	// ReadCommitted the transactions see the changes committed after they began,
+	// otherwise they read from the snapshot when they begin
+	ReadCommitted bool
+}
+
+// Run all the tests as subtests
+func (s Suite) Run(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, kvstore.Store)
+	}{
+		{"Basic", s.basic},
+		{"Order", s.order},
+		{"Seek", s.seek},
+		{"Stop", s.stop},
+		{"ReadYourWrites", s.readYourWrites},
+		{"DeleteDuringIteration", s.deleteDuringIteration},
+		{"Rollback", s.rollback},
+		{"Isolation", s.isolation},
+		{"Conflict", s.conflict},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			db := s.Open()
+			defer func() {
+				if c, ok := db.(interface{ Close() error }); ok {
+					assert.NoError(t, c.Close())
+				}
+			}()
+			test.fn(t, db)
+		})
+	}
+}
+
+func (s Suite) basic(t *testing.T, db kvstore.Store) {
+	set(t, db, "k", "v", "empty", "")
+
+	view(t, db, func(txn kvstore.Txn) {
+		v, err := txn.Get([]byte("k"))
+		assert.NoError(t, err)
+		assert.Equal(t, "v", string(v))
+
+		v, err = txn.Get([]byte("empty"))
+		assert.NoError(t, err)
+		assert.Len(t, v, 0)
+
+		_, err = txn.Get([]byte("missing"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+	})
+
+	// overwrite and delete
+	set(t, db, "k", "v2")
+	update(t, db, func(txn kvstore.Txn) {
+		assert.NoError(t, txn.Delete([]byte("empty")))
+		// deleting a missing key is not an error
+		assert.NoError(t, txn.Delete([]byte("missing")))
+	})
+
+	view(t, db, func(txn kvstore.Txn) {
+		v, err := txn.Get([]byte("k"))
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", string(v))
+
+		_, err = txn.Get([]byte("empty"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+
+		assert.Equal(t, []string{"k"}, keys(t, txn, false, nil))
+	})
+}
+
+// the order must be byte-wise, the keys are more than the common prefetch sizes
+func (s Suite) order(t *testing.T, db kvstore.Store) {
+	expected := []string{}
+	update(t, db, func(txn kvstore.Txn) {
+		for i := 0; i < 120; i++ {
+			key := fmt.Sprintf("%03d", i)
+			expected = append(expected, key)
+			assert.NoError(t, txn.Set([]byte(key), []byte(key)))
+		}
+	})
+
+	set(t, db, "a", "", "a\x00", "", "ab", "", "b", "", "\xff", "")
+	expected = append(expected, "a", "a\x00", "ab", "b", "\xff")
+
+	view(t, db, func(txn kvstore.Txn) {
+		assert.Equal(t, expected, keys(t, txn, false, nil))
+		assert.Equal(t, reversed(expected), keys(t, txn, true, nil))
+	})
+}
+
+// the forward iteration begins with the first key greater than or equal to the from,
+// the reverse iteration begins with the last key less than or equal to the from
+func (s Suite) seek(t *testing.T, db kvstore.Store) {
+	set(t, db, "b", "", "d", "", "a", "", "c", "")
+
+	view(t, db, func(txn kvstore.Txn) {
+		assert.Equal(t, []string{"a", "b", "c", "d"}, keys(t, txn, false, nil))
+		assert.Equal(t, []string{"a", "b", "c", "d"}, keys(t, txn, false, []byte("")))
+		assert.Equal(t, []string{"b", "c", "d"}, keys(t, txn, false, []byte("b")))
+		assert.Equal(t, []string{"c", "d"}, keys(t, txn, false, []byte("bb")))
+		assert.Equal(t, []string{}, keys(t, txn, false, []byte("e")))
+
+		assert.Equal(t, []string{"d", "c", "b", "a"}, keys(t, txn, true, nil))
+		assert.Equal(t, []string{"b", "a"}, keys(t, txn, true, []byte("b")))
+		assert.Equal(t, []string{"b", "a"}, keys(t, txn, true, []byte("bb")))
+		assert.Equal(t, []string{"d", "c", "b", "a"}, keys(t, txn, true, []byte("e")))
+		assert.Equal(t, []string{}, keys(t, txn, true, []byte("0")))
+	})
+}
+
+func (s Suite) stop(t *testing.T, db kvstore.Store) {
+	set(t, db, "a", "", "b", "", "c", "")
+
+	view(t, db, func(txn kvstore.Txn) {
+		for _, reverse := range []bool{false, true} {
+			count := 0
+			err := txn.Do(reverse, nil, func(key []byte) error {
+				count++
+				if count == 2 {
+					return kvstore.ErrStop
+				}
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, count)
+		}
+
+		errTest := errors.New("test")
+		err := txn.Do(false, nil, func(key []byte) error {
+			return errTest
+		})
+		assert.Equal(t, errTest, err)
+	})
+}
+
+func (s Suite) readYourWrites(t *testing.T, db kvstore.Store) {
+	set(t, db, "a", "1", "c", "1", "e", "1")
+
+	update(t, db, func(txn kvstore.Txn) {
+		assert.NoError(t, txn.Set([]byte("b"), []byte("2")))
+		assert.NoError(t, txn.Set([]byte("c"), []byte("2")))
+		assert.NoError(t, txn.Delete([]byte("e")))
+
+		v, err := txn.Get([]byte("b"))
+		assert.NoError(t, err)
+		assert.Equal(t, "2", string(v))
+
+		v, err = txn.Get([]byte("c"))
+		assert.NoError(t, err)
+		assert.Equal(t, "2", string(v))
+
+		_, err = txn.Get([]byte("e"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+
+		assert.Equal(t, []string{"a", "b", "c"}, keys(t, txn, false, nil))
+		assert.Equal(t, []string{"c", "b", "a"}, keys(t, txn, true, nil))
+		assert.Equal(t, []string{"b", "c"}, keys(t, txn, false, []byte("b")))
+		assert.Equal(t, []string{"c", "b", "a"}, keys(t, txn, true, []byte("e")))
+
+		// set the deleted key again
+		assert.NoError(t, txn.Set([]byte("e"), []byte("3")))
+		v, err = txn.Get([]byte("e"))
+		assert.NoError(t, err)
+		assert.Equal(t, "3", string(v))
+	})
+
+	view(t, db, func(txn kvstore.Txn) {
+		assert.Equal(t, []string{"a", "b", "c", "e"}, keys(t, txn, false, nil))
+	})
+}
+
+func (s Suite) deleteDuringIteration(t *testing.T, db kvstore.Store) {
+	for _, reverse := range []bool{false, true} {
+		update(t, db, func(txn kvstore.Txn) {
+			for i := 0; i < 100; i++ {
+				assert.NoError(t, txn.Set([]byte(fmt.Sprintf("%02d", i)), nil))
+			}
+		})
+
+		count := 0
+		update(t, db, func(txn kvstore.Txn) {
+			assert.NoError(t, txn.Do(reverse, nil, func(key []byte) error {
+				count++
+				return txn.Delete(key)
+			}))
+		})
+		assert.Equal(t, 100, count)
+
+		view(t, db, func(txn kvstore.Txn) {
+			assert.Equal(t, []string{}, keys(t, txn, false, nil))
+		})
+	}
+}
+
+// the writes are discarded if the fn returns an error
+func (s Suite) rollback(t *testing.T, db kvstore.Store) {
+	set(t, db, "a", "1")
+
+	errTest := errors.New("test")
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		assert.NoError(t, txn.Set([]byte("a"), []byte("2")))
+		assert.NoError(t, txn.Set([]byte("b"), []byte("2")))
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+
+	err = db.Do(false, func(txn kvstore.Txn) error {
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+
+	view(t, db, func(txn kvstore.Txn) {
+		v, err := txn.Get([]byte("a"))
+		assert.NoError(t, err)
+		assert.Equal(t, "1", string(v))
+		assert.Equal(t, []string{"a"}, keys(t, txn, false, nil))
+	})
+}
+
+func (s Suite) isolation(t *testing.T, db kvstore.Store) {
+	set(t, db, "a", "1")
+
+	// the writes are invisible to others until committed
+	update(t, db, func(txn kvstore.Txn) {
+		assert.NoError(t, txn.Set([]byte("b"), []byte("2")))
+
+		view(t, db, func(other kvstore.Txn) {
+			_, err := other.Get([]byte("b"))
+			assert.Equal(t, kvstore.ErrKeyNotFound, err)
+			assert.Equal(t, []string{"a"}, keys(t, other, false, nil))
+		})
+	})
+
+	view(t, db, func(txn kvstore.Txn) {
+		// make sure the transaction has begun
+		_, err := txn.Get([]byte("a"))
+		assert.NoError(t, err)
+
+		set(t, db, "a", "2", "c", "3")
+
+		v, err := txn.Get([]byte("a"))
+		assert.NoError(t, err)
+		if s.ReadCommitted {
+			assert.Equal(t, "2", string(v))
+			assert.Equal(t, []string{"a", "b", "c"}, keys(t, txn, false, nil))
+		} else {
+			assert.Equal(t, "1", string(v))
+			assert.Equal(t, []string{"a", "b"}, keys(t, txn, false, nil))
+		}
+	})
+}
+
+func (s Suite) conflict(t *testing.T, db kvstore.Store) {
+	if !assert.Error(t, s.Conflict, "the adapter must detect conflicts") {
+		return
+	}
+
+	set(t, db, "a", "1")
+
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("a"))
+		assert.NoError(t, err)
+
+		set(t, db, "a", "2")
+
+		return txn.Set([]byte("b"), []byte("1"))
+	})
+	assert.Equal(t, s.Conflict, err)
+
+	view(t, db, func(txn kvstore.Txn) {
+		v, _ := txn.Get([]byte("a"))
+		assert.Equal(t, "2", string(v))
+
+		_, getErr := txn.Get([]byte("b"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, getErr)
+	})
+}
+
+func set(t *testing.T, db kvstore.Store, kvs ...string) {
+	update(t, db, func(txn kvstore.Txn) {
+		for i := 0; i < len(kvs); i += 2 {
+			assert.NoError(t, txn.Set([]byte(kvs[i]), []byte(kvs[i+1])))
+		}
+	})
+}
+
+func update(t *testing.T, db kvstore.Store, fn func(kvstore.Txn)) {
+	assert.NoError(t, db.Do(true, func(txn kvstore.Txn) error {
+		fn(txn)
+		return nil
+	}))
+}
+
+func view(t *testing.T, db kvstore.Store, fn func(kvstore.Txn)) {
+	assert.NoError(t, db.Do(false, func(txn kvstore.Txn) error {
+		fn(txn)
+		return nil
+	}))
+}
+
+// the keys are copied, they may be only valid during the iteratee
+func keys(t *testing.T, txn kvstore.Txn, reverse bool, from []byte) []string {
+	list := []string{}
+	assert.NoError(t, txn.Do(reverse, from, func(key []byte) error {
+		list = append(list, string(key))
+		return nil
+	}))
+	return list
+}
+
+func reversed(list []string) []string {
+	r := make([]string, len(list))
+	for i, s := range list {
+		r[len(list)-1-i] = s
+	}
+	return r
+}
@@ -0,0 +1,96 @@
+package kvstore
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Fetch get a batch of the keys after the from in the iteration order, the from is included if the inclusive
+// is true, the nil from means no limit. A batch that is not full means there are no more keys.
+type Fetch func(reverse bool, from []byte, inclusive bool) ([][]byte, error)
+
+// Prefetch a helper for the adapters that buffer the writes of the update transactions, it iterates the keys
+// via the batches of the fetch, each batch holds at most the size keys. Each batch is merged with the writes
+// when it's fetched, the nil value in the writes means deletion, so the writes during the iteration are
+// visible to it if they are after the current batch.
+// The reverse iteration begins with the last key less than or equal to the from, if the from is nil it
+// begins with the last key.
+func Prefetch(size int, writes map[string][]byte, reverse bool, from []byte, fetch Fetch, fn Iteratee) error {
+	inclusive := true
+	for {
+		keys, err := fetch(reverse, from, inclusive)
+		if err != nil {
+			return err
+		}
+
+		// the batch is the rest of the keys if it's not full
+		var end []byte
+		if len(keys) == size {
+			end = keys[len(keys)-1]
+		}
+
+		for _, key := range merge(writes, keys, reverse, from, inclusive, end) {
+			err := fn(key)
+			if err == ErrStop {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if end == nil {
+			return nil
+		}
+		from, inclusive = end, false
+	}
+}
+
+// merge the writes between the from and the end into the keys fetched, the nil end means no limit
+func merge(writes map[string][]byte, keys [][]byte, reverse bool, from []byte, inclusive bool, end []byte) [][]byte {
+	if len(writes) == 0 {
+		return keys
+	}
+
+	// compare the keys in the iteration order
+	cmp := func(a, b []byte) int {
+		if reverse {
+			return bytes.Compare(b, a)
+		}
+		return bytes.Compare(a, b)
+	}
+
+	list := [][]byte{}
+	fetched := map[string]struct{}{}
+	for _, key := range keys {
+		fetched[string(key)] = struct{}{}
+		if val, has := writes[string(key)]; !has || val != nil {
+			list = append(list, key)
+		}
+	}
+
+	for k, val := range writes {
+		key := []byte(k)
+		if val == nil {
+			continue
+		}
+		if from != nil {
+			c := cmp(key, from)
+			if c < 0 || (c == 0 && !inclusive) {
+				continue
+			}
+		}
+		if end != nil && cmp(key, end) > 0 {
+			continue
+		}
+		if _, has := fetched[k]; has {
+			continue
+		}
+		list = append(list, key)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return cmp(list[i], list[j]) < 0
+	})
+	return list
+}
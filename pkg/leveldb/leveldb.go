@@ -0,0 +1,282 @@
+// Package leveldb is the adapter for goleveldb, a LSM store which has lower write amplification than badger
+// because the values are stored along with the keys.
+package leveldb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/ysmood/kit/pkg/utils"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// the flags of the values in the batch of a transaction
+const (
+	flagDeleted byte = iota
+	flagSet
+)
+
+// ErrConflict the update transaction read a key that was changed by another transaction committed after
+// the transaction began, the transaction is discarded, retry it if needed
+var ErrConflict = errors.New("[storer.leveldb] transaction conflict")
+
+// LevelDB adapter for goleveldb. The native TTL isn't supported, storer will track the expiry by itself.
+type LevelDB struct {
+	db *leveldb.DB
+
+	// lock serializes the commits, so that the keys read won't change between the check and the write
+	lock sync.Mutex
+}
+
+var _ kvstore.Store = &LevelDB{}
+
+// New a helper to create a goleveldb adapter instance.
+// If the dir is empty a tmp dir will be created.
+func New(dir string) *LevelDB {
+	if dir == "" {
+		dir = filepath.Join("tmp", utils.RandString(10))
+	}
+
+	err := os.MkdirAll(dir, 0775)
+	utils.E(err)
+
+	db, err := leveldb.OpenFile(dir, nil)
+	utils.E(err)
+
+	return NewByDB(db)
+}
+
+// NewByDB ...
+func NewByDB(db *leveldb.DB) *LevelDB {
+	return &LevelDB{
+		db: db,
+	}
+}
+
+// Do each transaction reads from the snapshot when it begins. The writes of an update transaction
+// are kept in an indexed batch, so that the transaction can read its own writes, and they are written
+// atomically when the fn returns. Before the write, the values read via Get are compared with the latest
+// ones, if any of them has been changed ErrConflict will be returned.
+func (l *LevelDB) Do(update bool, fn kvstore.DoTxn) error {
+	snapshot, err := l.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+
+	txn := &Txn{snapshot: snapshot}
+	if update {
+		txn.batch = memdb.New(comparer.DefaultComparer, 0)
+		txn.reads = map[string][]byte{}
+	}
+
+	err = fn(txn)
+	if err != nil || !update || txn.batch.Len() == 0 {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	it := txn.batch.NewIterator(nil)
+	defer it.Release()
+	for it.Next() {
+		if it.Value()[0] == flagDeleted {
+			batch.Delete(it.Key())
+		} else {
+			batch.Put(it.Key(), it.Value()[1:])
+		}
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for key, read := range txn.reads {
+		value, err := get(l.db, []byte(key))
+		if err != nil {
+			return err
+		}
+		if (value == nil) != (read == nil) || !bytes.Equal(value, read) {
+			return ErrConflict
+		}
+	}
+
+	return l.db.Write(batch, nil)
+}
+
+// Close ...
+func (l *LevelDB) Close() error {
+	return l.db.Close()
+}
+
+// Txn ...
+type Txn struct {
+	snapshot *leveldb.Snapshot
+
+	// batch the writes of the transaction, each value begins with a flag byte,
+	// it's nil for the read transactions
+	batch *memdb.DB
+
+	// reads the values read via Get, the nil value means the key doesn't exist,
+	// it's nil for the read transactions
+	reads map[string][]byte
+}
+
+var _ kvstore.Txn = &Txn{}
+
+// Get ...
+func (t *Txn) Get(key []byte) ([]byte, error) {
+	if t.batch != nil {
+		value, err := t.batch.Get(key)
+		if err == nil {
+			if value[0] == flagDeleted {
+				return nil, kvstore.ErrKeyNotFound
+			}
+			return append([]byte{}, value[1:]...), nil
+		}
+	}
+
+	value, err := get(t.snapshot, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the first read matters
+	if _, has := t.reads[string(key)]; t.reads != nil && !has {
+		t.reads[string(key)] = value
+	}
+
+	if value == nil {
+		return nil, kvstore.ErrKeyNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+// get the value of the key, it's nil if the key doesn't exist, the empty value is non-nil
+func get(db leveldb.Reader, key []byte) ([]byte, error) {
+	value, err := db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Set ...
+func (t *Txn) Set(key, value []byte) error {
+	if t.batch == nil {
+		return leveldb.ErrReadOnly
+	}
+	return t.batch.Put(key, append([]byte{flagSet}, value...))
+}
+
+// Delete ...
+func (t *Txn) Delete(key []byte) error {
+	if t.batch == nil {
+		return leveldb.ErrReadOnly
+	}
+	return t.batch.Put(key, []byte{flagDeleted})
+}
+
+// Do the reverse iteration begins with the last key less than or equal to the from,
+// if the from is nil it begins with the last key. The writes during the iteration are visible
+// to the iteration if they are ahead of the current key.
+func (t *Txn) Do(reverse bool, from []byte, fn kvstore.Iteratee) error {
+	it := t.snapshot.NewIterator(nil, nil)
+	defer it.Release()
+	ok := seek(it, reverse, from)
+
+	if t.batch == nil {
+		for ; ok; ok = step(it, reverse) {
+			err := fn(append([]byte{}, it.Key()...))
+			if err != nil {
+				return stop(err)
+			}
+		}
+		return it.Error()
+	}
+
+	bit := t.batch.NewIterator(nil)
+	defer bit.Release()
+	bok := seek(bit, reverse, from)
+
+	for ok || bok {
+		// compare the keys in the iteration order, the batch wins if they are the same
+		c := 1
+		if ok && bok {
+			c = bytes.Compare(it.Key(), bit.Key())
+			if reverse {
+				c = -c
+			}
+		} else if ok {
+			c = -1
+		}
+
+		var key []byte
+		var deleted bool
+		if c < 0 {
+			key = append([]byte{}, it.Key()...)
+		} else {
+			key = append([]byte{}, bit.Key()...)
+			deleted = bit.Value()[0] == flagDeleted
+		}
+
+		// move the iterators before the fn, so the fn can modify the batch
+		if c <= 0 {
+			ok = step(it, reverse)
+		}
+		if c >= 0 {
+			bok = step(bit, reverse)
+		}
+
+		if deleted {
+			continue
+		}
+
+		err := fn(key)
+		if err != nil {
+			return stop(err)
+		}
+	}
+	return it.Error()
+}
+
+func seek(it iterator.Iterator, reverse bool, from []byte) bool {
+	if !reverse {
+		if from == nil {
+			return it.First()
+		}
+		return it.Seek(from)
+	}
+
+	if from == nil {
+		return it.Last()
+	}
+	if !it.Seek(from) {
+		return it.Last()
+	}
+	if !bytes.Equal(it.Key(), from) {
+		return it.Prev()
+	}
+	return true
+}
+
+func step(it iterator.Iterator, reverse bool) bool {
+	if reverse {
+		return it.Prev()
+	}
+	return it.Next()
+}
+
+func stop(err error) error {
+	if err == kvstore.ErrStop {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package leveldb_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	goleveldb "github.com/syndtr/goleveldb/leveldb"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/kvstore/kvtest"
+	"github.com/ysmood/storer/pkg/leveldb"
+)
+
+func open() (*goleveldb.DB, *leveldb.LevelDB) {
+	db, err := goleveldb.OpenFile(filepath.Join("tmp", kit.RandString(10)), nil)
+	kit.E(err)
+	return db, leveldb.NewByDB(db)
+}
+
+func TestSnapshotRelease(t *testing.T) {
+	raw, db := open()
+
+	alive := func() string {
+		snaps, err := raw.GetProperty("leveldb.alivesnaps")
+		kit.E(err)
+		iters, err := raw.GetProperty("leveldb.aliveiters")
+		kit.E(err)
+		return snaps + " " + iters
+	}
+
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		return txn.Set([]byte("a"), nil)
+	}))
+
+	testErr := errors.New("err")
+	for _, update := range []bool{false, true} {
+		err := db.Do(update, func(txn kvstore.Txn) error {
+			assert.Equal(t, "1 0", alive())
+
+			// stop in the middle of the iteration
+			kit.E(txn.Do(false, nil, func([]byte) error {
+				return kvstore.ErrStop
+			}))
+			return testErr
+		})
+		assert.Equal(t, testErr, err)
+		assert.Equal(t, "0 0", alive())
+	}
+}
+
+func TestBatchFlags(t *testing.T) {
+	_, db := open()
+
+	// the values that look like the flags
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Set([]byte("a"), []byte{0}))
+		kit.E(txn.Set([]byte("b"), []byte{1}))
+		kit.E(txn.Set([]byte("c"), nil))
+		kit.E(txn.Set([]byte("d"), nil))
+		kit.E(txn.Delete([]byte("d")))
+
+		value, err := txn.Get([]byte("a"))
+		kit.E(err)
+		assert.Equal(t, []byte{0}, value)
+
+		_, err = txn.Get([]byte("d"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+		return nil
+	}))
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		for k, v := range map[string][]byte{"a": {0}, "b": {1}, "c": {}} {
+			value, err := txn.Get([]byte(k))
+			kit.E(err)
+			assert.Equal(t, v, value)
+		}
+
+		_, err := txn.Get([]byte("d"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+
+		assert.Equal(t, goleveldb.ErrReadOnly, txn.Set([]byte("a"), nil))
+		return nil
+	}))
+}
+
+// the empty value and the missing key are different for the conflict detection
+func TestConflictEmptyValue(t *testing.T) {
+	_, db := open()
+
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("a"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			return txn.Set([]byte("a"), nil)
+		}))
+
+		return txn.Set([]byte("a"), []byte("1"))
+	})
+	assert.Equal(t, leveldb.ErrConflict, err)
+}
+
+func TestSuite(t *testing.T) {
+	kvtest.Suite{
+		Open:     func() kvstore.Store { return leveldb.New("") },
+		Conflict: leveldb.ErrConflict,
+	}.Run(t)
+}
@@ -0,0 +1,326 @@
+// Package memory is a pure in-memory kvstore.Store, it's a fast backend for tests and caches.
+//
+// The data is an immutable ordered tree, each committed transaction creates a new root that shares the
+// unchanged nodes with the previous one, so a read transaction simply holds the root when it begins, and
+// a snapshot of the whole store costs nothing.
+package memory
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// ErrConflict the update transaction read a key that was changed by another transaction committed after
+// it began, the transaction is discarded, retry it if needed
+var ErrConflict = errors.New("[storer.memory] transaction conflict")
+
+// ErrReadOnly write in a read transaction
+var ErrReadOnly = errors.New("[storer.memory] transaction is read only")
+
+// ErrDiscarded the transaction is used after it's done
+var ErrDiscarded = errors.New("[storer.memory] transaction is discarded")
+
+// Memory the store. It supports the native TTL, the expired keys are removed by the commits after they expire.
+type Memory struct {
+	lock sync.Mutex
+
+	root    *node
+	version uint64
+
+	// commits the version of the last commit of each key that's written after the oldest running
+	// update transaction began, it's used to detect conflicts
+	commits map[string]uint64
+
+	// running the number of the running update transactions of each begin version
+	running map[uint64]int
+
+	// expiries the keys written with TTL, the earliest first, the expired ones are removed on each commit
+	expiries expiries
+
+	notifiers map[int]func(prefixes [][]byte)
+	lastID    int
+}
+
+var _ kvstore.Notifier = &Memory{}
+
+// New ...
+func New() *Memory {
+	return &Memory{
+		commits:   map[string]uint64{},
+		running:   map[uint64]int{},
+		notifiers: map[int]func(prefixes [][]byte){},
+	}
+}
+
+// Do a read transaction sees the snapshot when it begins. An update transaction also sees its own writes,
+// it returns ErrConflict if a key it read is committed by others after it began.
+func (m *Memory) Do(update bool, fn kvstore.DoTxn) error {
+	m.lock.Lock()
+	root, version := m.root, m.version
+	if update {
+		m.running[version]++
+	}
+	m.lock.Unlock()
+
+	txn := &Txn{root: root, update: update}
+	if update {
+		txn.reads = map[string]struct{}{}
+		defer m.done(version)
+	}
+
+	err := fn(txn)
+	txn.discarded = true
+	if err != nil || !update || len(txn.writes) == 0 {
+		return err
+	}
+
+	err = m.commit(txn, version)
+	if err != nil {
+		return err
+	}
+
+	m.notify(txn.writes)
+	return nil
+}
+
+// Notify the fn is called in the goroutine of the committed transaction
+func (m *Memory) Notify(fn func(prefixes [][]byte)) (func() error, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.lastID++
+	id := m.lastID
+	m.notifiers[id] = fn
+
+	return func() error {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		delete(m.notifiers, id)
+		return nil
+	}, nil
+}
+
+func (m *Memory) notify(writes []*write) {
+	m.lock.Lock()
+	list := make([]func([][]byte), 0, len(m.notifiers))
+	for _, fn := range m.notifiers {
+		list = append(list, fn)
+	}
+	m.lock.Unlock()
+
+	if len(list) == 0 {
+		return
+	}
+
+	prefixes := [][]byte{}
+	seen := map[string]struct{}{}
+	for _, w := range writes {
+		prefix := bucket.PrefixOf(w.key)
+		if _, has := seen[string(prefix)]; !has {
+			seen[string(prefix)] = struct{}{}
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	for _, fn := range list {
+		fn(prefixes)
+	}
+}
+
+// Close ...
+func (m *Memory) Close() error {
+	return nil
+}
+
+// Snapshot create a copy of the store, the changes of the copy and the original won't affect each other.
+func (m *Memory) Snapshot() *Memory {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := New()
+	s.root, s.version = m.root, m.version
+	s.expiries = append(expiries{}, m.expiries...)
+	return s
+}
+
+// Sweep remove the expired keys from the store, the expired keys are invisible to the transactions,
+// each commit also removes them, so it's only needed when there's no commit for a long time
+func (m *Memory) Sweep() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.expire(time.Now().UnixNano())
+	return nil
+}
+
+// expire remove the keys expired at the now, the running transactions still see them via their own roots
+func (m *Memory) expire(now int64) {
+	for len(m.expiries) > 0 && m.expiries[0].expireAt <= now {
+		e := heap.Pop(&m.expiries).(*expiry)
+
+		// the key may be rewritten after the expiry is pushed
+		if n := get(m.root, e.key); n != nil && n.expired(now) {
+			m.root = remove(m.root, e.key)
+		}
+	}
+}
+
+func (m *Memory) commit(txn *Txn, version uint64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for key := range txn.reads {
+		if m.commits[key] > version {
+			return ErrConflict
+		}
+	}
+
+	m.version++
+	root := m.root
+	for _, w := range txn.writes {
+		if w.deleted {
+			root = remove(root, w.key)
+		} else {
+			root = insert(root, newNode(w.key, w.value, w.expireAt))
+			if w.expireAt != 0 {
+				heap.Push(&m.expiries, &expiry{key: w.key, expireAt: w.expireAt})
+			}
+		}
+		m.commits[string(w.key)] = m.version
+	}
+	m.root = root
+
+	m.expire(time.Now().UnixNano())
+	return nil
+}
+
+// done remove the commit versions that no running transaction can conflict with
+func (m *Memory) done(version uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.running[version]--
+	if m.running[version] == 0 {
+		delete(m.running, version)
+	}
+
+	oldest := m.version
+	for v := range m.running {
+		if v < oldest {
+			oldest = v
+		}
+	}
+
+	for key, v := range m.commits {
+		if v <= oldest {
+			delete(m.commits, key)
+		}
+	}
+}
+
+// Txn ...
+type Txn struct {
+	// root the snapshot with the writes of the transaction applied
+	root   *node
+	update bool
+
+	reads  map[string]struct{}
+	writes []*write
+
+	discarded bool
+}
+
+var _ kvstore.TTLTxn = &Txn{}
+
+type write struct {
+	key      []byte
+	value    []byte
+	expireAt int64
+	deleted  bool
+}
+
+// Get ...
+func (t *Txn) Get(key []byte) ([]byte, error) {
+	if t.discarded {
+		return nil, ErrDiscarded
+	}
+	t.read(key)
+
+	n := get(t.root, key)
+	if n == nil || n.expired(time.Now().UnixNano()) {
+		return nil, kvstore.ErrKeyNotFound
+	}
+	return append([]byte{}, n.value...), nil
+}
+
+// Set ...
+func (t *Txn) Set(key, value []byte) error {
+	return t.set(&write{key: key, value: value})
+}
+
+// SetWithTTL ...
+func (t *Txn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	return t.set(&write{key: key, value: value, expireAt: time.Now().Add(ttl).UnixNano()})
+}
+
+// Delete ...
+func (t *Txn) Delete(key []byte) error {
+	return t.set(&write{key: key, deleted: true})
+}
+
+func (t *Txn) set(w *write) error {
+	if t.discarded {
+		return ErrDiscarded
+	}
+	if !t.update {
+		return ErrReadOnly
+	}
+
+	// the caller may reuse the slices
+	w.key = append([]byte{}, w.key...)
+	w.value = append([]byte{}, w.value...)
+
+	t.writes = append(t.writes, w)
+	if w.deleted {
+		t.root = remove(t.root, w.key)
+	} else {
+		t.root = insert(t.root, newNode(w.key, w.value, w.expireAt))
+	}
+	return nil
+}
+
+// Do the keys passed to the fn must not be modified. The iterated keys of an update transaction
+// are treated as read.
+func (t *Txn) Do(reverse bool, from []byte, fn kvstore.Iteratee) error {
+	if t.discarded {
+		return ErrDiscarded
+	}
+
+	now := time.Now().UnixNano()
+
+	// the snapshot won't change even if the fn writes
+	return iterate(t.root, reverse, from, func(n *node) (bool, error) {
+		if n.expired(now) {
+			return true, nil
+		}
+
+		t.read(n.key)
+
+		err := fn(n.key)
+		if err == kvstore.ErrStop {
+			return false, nil
+		}
+		return err == nil, err
+	})
+}
+
+func (t *Txn) read(key []byte) {
+	if t.update {
+		t.reads[string(key)] = struct{}{}
+	}
+}
@@ -0,0 +1,167 @@
+package memory_test
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/kvstore/kvtest"
+	"github.com/ysmood/storer/pkg/memory"
+)
+
+func set(db kvstore.Store, kvs ...string) {
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		for i := 0; i < len(kvs); i += 2 {
+			err := txn.Set([]byte(kvs[i]), []byte(kvs[i+1]))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func keys(txn kvstore.Txn, reverse bool, from []byte) []string {
+	list := []string{}
+	kit.E(txn.Do(reverse, from, func(key []byte) error {
+		list = append(list, string(key))
+		return nil
+	}))
+	return list
+}
+
+func TestRandom(t *testing.T) {
+	db := memory.New()
+	dict := map[string]bool{}
+
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprint(r.Intn(500))
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			if r.Intn(3) == 0 {
+				delete(dict, key)
+				return txn.Delete([]byte(key))
+			}
+			dict[key] = true
+			return txn.Set([]byte(key), []byte(key))
+		}))
+	}
+
+	expected := []string{}
+	for k := range dict {
+		expected = append(expected, k)
+	}
+	sort.Strings(expected)
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		assert.Equal(t, expected, keys(txn, false, nil))
+
+		reversed := keys(txn, true, nil)
+		sort.Strings(reversed)
+		assert.Equal(t, expected, reversed)
+		return nil
+	}))
+}
+
+// the writes that don't depend on any read never conflict
+func TestBlindWrite(t *testing.T) {
+	db := memory.New()
+	set(db, "a", "1")
+
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		set(db, "a", "2")
+		return txn.Set([]byte("a"), []byte("3"))
+	}))
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		value, _ := txn.Get([]byte("a"))
+		assert.Equal(t, "3", string(value))
+
+		assert.Equal(t, memory.ErrReadOnly, txn.Set([]byte("a"), nil))
+		return nil
+	}))
+}
+
+func TestSnapshot(t *testing.T) {
+	db := memory.New()
+	set(db, "a", "1")
+
+	snapshot := db.Snapshot()
+	set(db, "a", "2")
+	set(snapshot, "b", "1")
+
+	kit.E(snapshot.Do(false, func(txn kvstore.Txn) error {
+		value, _ := txn.Get([]byte("a"))
+		assert.Equal(t, "1", string(value))
+		assert.Equal(t, []string{"a", "b"}, keys(txn, false, nil))
+		return nil
+	}))
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		value, _ := txn.Get([]byte("a"))
+		assert.Equal(t, "2", string(value))
+		assert.Equal(t, []string{"a"}, keys(txn, false, nil))
+		return nil
+	}))
+}
+
+func TestTTL(t *testing.T) {
+	db := memory.New()
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Set([]byte("a"), nil))
+		return txn.(kvstore.TTLTxn).SetWithTTL([]byte("b"), nil, time.Millisecond)
+	}))
+
+	time.Sleep(2 * time.Millisecond)
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("b"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+		assert.Equal(t, []string{"a"}, keys(txn, false, nil))
+		return nil
+	}))
+
+	snapshot := db.Snapshot()
+	kit.E(db.Sweep())
+	kit.E(snapshot.Do(false, func(txn kvstore.Txn) error {
+		assert.Equal(t, []string{"a"}, keys(txn, false, nil))
+		return nil
+	}))
+}
+
+// the expired values are freed by the commits without Sweep
+func TestTTLBounded(t *testing.T) {
+	db := memory.New()
+	value := make([]byte, 1<<16)
+
+	heapAlloc := func() uint64 {
+		runtime.GC()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+
+	before := heapAlloc()
+	for i := 0; i < 1000; i++ {
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			return txn.(kvstore.TTLTxn).SetWithTTL([]byte(fmt.Sprint(i)), value, time.Nanosecond)
+		}))
+	}
+
+	// all the values would take 64MB
+	assert.Less(t, int64(heapAlloc())-int64(before), int64(8<<20))
+	runtime.KeepAlive(db)
+}
+
+func TestSuite(t *testing.T) {
+	kvtest.Suite{
+		Open:     func() kvstore.Store { return memory.New() },
+		Conflict: memory.ErrConflict,
+	}.Run(t)
+}
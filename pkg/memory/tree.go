@@ -0,0 +1,223 @@
+package memory
+
+import (
+	"bytes"
+	"hash/fnv"
+)
+
+// node of an immutable treap, a change to the tree copies the nodes on the path from the root,
+// so a root is a snapshot that never changes. The priority is the hash of the key, so the shape of
+// the tree only depends on the keys.
+type node struct {
+	key      []byte
+	value    []byte
+	expireAt int64
+	priority uint32
+
+	left, right *node
+}
+
+func newNode(key, value []byte, expireAt int64) *node {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return &node{key: key, value: value, expireAt: expireAt, priority: h.Sum32()}
+}
+
+func (n *node) clone() *node {
+	c := *n
+	return &c
+}
+
+// the node is expired at the unix nano time
+func (n *node) expired(now int64) bool {
+	return n.expireAt != 0 && now >= n.expireAt
+}
+
+func get(n *node, key []byte) *node {
+	for n != nil {
+		switch c := bytes.Compare(key, n.key); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return nil
+}
+
+// insert returns the new root, the item replaces the node with the same key
+func insert(n, item *node) *node {
+	if n == nil {
+		return item
+	}
+
+	c := bytes.Compare(item.key, n.key)
+	if c == 0 {
+		item = item.clone()
+		item.left, item.right = n.left, n.right
+		return item
+	}
+
+	if item.priority > n.priority {
+		item = item.clone()
+		item.left, item.right = split(n, item.key)
+		return item
+	}
+
+	n = n.clone()
+	if c < 0 {
+		n.left = insert(n.left, item)
+	} else {
+		n.right = insert(n.right, item)
+	}
+	return n
+}
+
+// split the tree into the keys less than the key and the keys greater than the key, the key itself is dropped
+func split(n *node, key []byte) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+
+	switch c := bytes.Compare(n.key, key); {
+	case c < 0:
+		n = n.clone()
+		l, r := split(n.right, key)
+		n.right = l
+		return n, r
+	case c > 0:
+		n = n.clone()
+		l, r := split(n.left, key)
+		n.left = r
+		return l, n
+	default:
+		return n.left, n.right
+	}
+}
+
+// remove returns the new root, the same root is returned if the key doesn't exist
+func remove(n *node, key []byte) *node {
+	if n == nil {
+		return nil
+	}
+
+	switch c := bytes.Compare(key, n.key); {
+	case c < 0:
+		left := remove(n.left, key)
+		if left == n.left {
+			return n
+		}
+		n = n.clone()
+		n.left = left
+		return n
+	case c > 0:
+		right := remove(n.right, key)
+		if right == n.right {
+			return n
+		}
+		n = n.clone()
+		n.right = right
+		return n
+	default:
+		return merge(n.left, n.right)
+	}
+}
+
+// merge two trees, all the keys of a are less than the keys of b
+func merge(a, b *node) *node {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	if a.priority > b.priority {
+		a = a.clone()
+		a.right = merge(a.right, b)
+		return a
+	}
+	b = b.clone()
+	b.left = merge(a, b.left)
+	return b
+}
+
+// iterate the nodes from the key, forward begins with the first key greater than or equal to the key,
+// reverse begins with the last key less than or equal to the key, if the key is nil reverse begins
+// with the last key. Return false from the fn to stop.
+func iterate(n *node, reverse bool, from []byte, fn func(n *node) (bool, error)) error {
+	// the nodes whose subtrees on the iteration side are not visited yet
+	stack := []*node{}
+
+	for n != nil {
+		c := 0
+		if from != nil || !reverse {
+			c = bytes.Compare(n.key, from)
+		} else {
+			c = -1
+		}
+
+		if reverse {
+			c = -c
+		}
+
+		switch {
+		case c > 0:
+			stack = append(stack, n)
+			n = next(n, reverse, true)
+		case c < 0:
+			n = next(n, reverse, false)
+		default:
+			stack = append(stack, n)
+			n = nil
+		}
+	}
+
+	for len(stack) > 0 {
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		ok, err := fn(n)
+		if err != nil || !ok {
+			return err
+		}
+
+		for n = next(n, reverse, false); n != nil; n = next(n, reverse, true) {
+			stack = append(stack, n)
+		}
+	}
+	return nil
+}
+
+// the child before the node in the iteration order if before is true, otherwise the child after it
+func next(n *node, reverse, before bool) *node {
+	if reverse == before {
+		return n.right
+	}
+	return n.left
+}
+
+// expiry the expire time of a key
+type expiry struct {
+	key      []byte
+	expireAt int64
+}
+
+// expiries a min-heap of the expire time
+type expiries []*expiry
+
+func (h expiries) Len() int           { return len(h) }
+func (h expiries) Less(i, j int) bool { return h[i].expireAt < h[j].expireAt }
+func (h expiries) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *expiries) Push(x interface{}) { *h = append(*h, x.(*expiry)) }
+
+func (h *expiries) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,191 @@
+package postgres_test
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// The benchmarks compare the adapter with the baseline, the baseline is the implementation before
+// the cursors, the batched writes and the prepared statements: each write is sent immediately, the
+// statements are not prepared, and the iteration pages the keys via LIMIT.
+
+func baseline() *sql.DB {
+	raw, err := sql.Open("postgres", db.ConnStr)
+	kit.E(err)
+	return raw
+}
+
+func baselineSet(tx *sql.Tx, key, value []byte) error {
+	_, err := tx.Exec(`INSERT INTO "store" (key, val) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET val = EXCLUDED.val`, key, value)
+	return err
+}
+
+func baselineGet(tx *sql.Tx, key []byte) ([]byte, error) {
+	var val []byte
+	err := tx.QueryRow(`SELECT val FROM "store" WHERE key = $1`, key).Scan(&val)
+	return val, err
+}
+
+// baselineIterate page the keys via LIMIT, each page is a query
+func baselineIterate(tx *sql.Tx, fn func(key []byte) error) error {
+	var from []byte
+	for {
+		where, args := `TRUE`, []interface{}{50}
+		if from != nil {
+			where, args = `key > $2`, append(args, from)
+		}
+
+		rows, err := tx.Query(`SELECT key FROM "store" WHERE `+where+` ORDER BY key LIMIT $1`, args...)
+		if err != nil {
+			return err
+		}
+		keys := [][]byte{}
+		for rows.Next() {
+			var key []byte
+			err = rows.Scan(&key)
+			if err != nil {
+				_ = rows.Close()
+				return err
+			}
+			keys = append(keys, key)
+		}
+		_ = rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, from = range keys {
+			err = fn(from)
+			if err != nil {
+				return err
+			}
+		}
+		if len(keys) < 50 {
+			return nil
+		}
+	}
+}
+
+func baselineDo(raw *sql.DB, fn func(tx *sql.Tx) error) {
+	tx, err := raw.Begin()
+	kit.E(err)
+	kit.E(fn(tx))
+	kit.E(tx.Commit())
+}
+
+func BenchmarkSet(b *testing.B) {
+	b.Run("adapter", func(b *testing.B) {
+		clean()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			kit.E(db.Do(true, func(txn kvstore.Txn) error {
+				for j := 0; j < 100; j++ {
+					err := txn.Set([]byte(fmt.Sprintf("%d-%d", i, j)), []byte("val"))
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+		}
+	})
+
+	b.Run("baseline", func(b *testing.B) {
+		clean()
+		raw := baseline()
+		defer func() { _ = raw.Close() }()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			baselineDo(raw, func(tx *sql.Tx) error {
+				for j := 0; j < 100; j++ {
+					err := baselineSet(tx, []byte(fmt.Sprintf("%d-%d", i, j)), []byte("val"))
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	clean()
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		return txn.Set([]byte("key"), []byte("val"))
+	}))
+
+	b.Run("adapter", func(b *testing.B) {
+		kit.E(db.Do(false, func(txn kvstore.Txn) error {
+			for i := 0; i < b.N; i++ {
+				_, err := txn.Get([]byte("key"))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	})
+
+	b.Run("baseline", func(b *testing.B) {
+		raw := baseline()
+		defer func() { _ = raw.Close() }()
+		b.ResetTimer()
+
+		baselineDo(raw, func(tx *sql.Tx) error {
+			for i := 0; i < b.N; i++ {
+				_, err := baselineGet(tx, []byte("key"))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func BenchmarkIterate(b *testing.B) {
+	clean()
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		for i := 0; i < 1000; i++ {
+			err := txn.Set([]byte(fmt.Sprintf("%04d", i)), []byte("val"))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	b.Run("adapter", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			kit.E(db.Do(false, func(txn kvstore.Txn) error {
+				return txn.Do(false, nil, func(key []byte) error {
+					_, err := txn.Get(key)
+					return err
+				})
+			}))
+		}
+	})
+
+	b.Run("baseline", func(b *testing.B) {
+		raw := baseline()
+		defer func() { _ = raw.Close() }()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			baselineDo(raw, func(tx *sql.Tx) error {
+				return baselineIterate(tx, func(key []byte) error {
+					_, err := baselineGet(tx, key)
+					return err
+				})
+			})
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrNoChannel Notify is called without the Channel or the ConnStr
+var ErrNoChannel = errors.New("[storer.postgres] the Channel and the ConnStr are required to listen")
+
+// the payload of NOTIFY must be shorter than 8000 bytes
+const maxPayload = 7999
+
+// notify the changed prefixes, the NOTIFY is delivered only if the transaction is committed.
+// If there are too many prefixes the payload will be empty, which means any key may have changed.
+func (t *Txn) notify() error {
+	if len(t.changed) == 0 {
+		return nil
+	}
+
+	list := make([]string, 0, len(t.changed))
+	for prefix := range t.changed {
+		list = append(list, hex.EncodeToString([]byte(prefix)))
+	}
+	sort.Strings(list)
+
+	payload := strings.Join(list, ",")
+	if len(payload) > maxPayload {
+		payload = ""
+	}
+
+	_, err := t.txn.Exec(`SELECT pg_notify($1, $2)`, t.db.Channel, payload)
+	return err
+}
+
+// Notify listen to the Channel via a dedicated connection, the fn is called in a separate goroutine in the
+// order of the commits. The prefixes are nil after a reconnection or if there were too many prefixes.
+func (pg *PG) Notify(fn func(prefixes [][]byte)) (func() error, error) {
+	if pg.Channel == "" || pg.ConnStr == "" {
+		return nil, ErrNoChannel
+	}
+
+	listener := pq.NewListener(pg.ConnStr, 10*time.Millisecond, time.Minute, nil)
+	err := listener.Listen(pg.Channel)
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// the channel will be closed when the listener is closed
+		for n := range listener.Notify {
+			// the nil means the connection is reestablished, the notifications may be lost
+			if n == nil {
+				fn(nil)
+				continue
+			}
+			fn(decodePayload(n.Extra))
+		}
+	}()
+
+	return func() error {
+		err := listener.Close()
+		<-done
+		return err
+	}, nil
+}
+
+func decodePayload(payload string) [][]byte {
+	if payload == "" {
+		return nil
+	}
+
+	prefixes := [][]byte{}
+	for _, s := range strings.Split(payload, ",") {
+		prefix, err := hex.DecodeString(s)
+		if err != nil {
+			return nil
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
@@ -1,28 +1,71 @@
 package postgres
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sync"
 
+	"github.com/lib/pq"
 	"github.com/ysmood/kit/pkg/utils"
+	"github.com/ysmood/storer/pkg/bucket"
 	"github.com/ysmood/storer/pkg/kvstore"
-
-	_ "github.com/lib/pq" // pg driver
 )
 
-// PG adapter
+// ErrReadOnly write in a read transaction
+var ErrReadOnly = errors.New("[storer.postgres] transaction is read only")
+
+// ErrConflict the update transaction read a key that was changed by another transaction committed after
+// the read, the transaction is discarded, retry it if needed
+var ErrConflict = errors.New("[storer.postgres] transaction conflict")
+
+// PG adapter, the transactions are at the read committed level.
+//
+// The values read via Get by an update transaction are checked again before the commit, and before the
+// writes of the same keys are sent, if any of them has been changed ErrConflict will be returned.
+// The rows checked are locked via "FOR UPDATE" until the transaction ends. The keys that didn't exist
+// are inserted via "ON CONFLICT DO NOTHING", so that the ones inserted by others are detected too.
 type PG struct {
 	db *sql.DB
 
+	// stmts the prepared statements of the queries
+	stmts sync.Map
+
+	// Schema of the table, if it's empty the search path of the connection will be used
+	Schema string
+
+	// Table by default is "store"
+	Table string
+
 	// PrefetchSize by default each time 50 keys will be fetched
 	PrefetchSize int
+
+	// BatchSize by default the buffered writes of a transaction will be sent when there are 1000 keys
+	BatchSize int
+
+	// Channel if it's not empty, each committed update transaction will NOTIFY the channel with the
+	// prefixes of the changed keys, the other processes can receive them via Notify
+	Channel string
+
+	// Prefix get the prefix of a changed key to notify, by default it's the bucket prefix of the key
+	Prefix func(key []byte) []byte
+
+	// ConnStr the connection string for the listener connection of Notify, it's set by New
+	ConnStr string
 }
 
-var _ kvstore.Store = &PG{}
+var _ kvstore.Notifier = &PG{}
 
 // New a helper to create an adapter instance.
 // If the connStr is empty a random database will be created.
 func New(connStr string) *PG {
+	return NewWithTable(connStr, "", "store")
+}
+
+// NewWithTable same as New, the schema and the table will be created if they don't exist
+func NewWithTable(connStr, schema, table string) *PG {
 	var dbName string
 	if connStr == "" {
 		dbName = utils.RandString(10)
@@ -40,159 +83,476 @@ func New(connStr string) *PG {
 		utils.E(err)
 	}
 
-	_, err = db.Query(`
-		CREATE TABLE IF NOT EXISTS store (
-			key bytea,
-			val bytea
-		);
-		CREATE INDEX IF NOT EXISTS idx_key ON store(key);
-	`)
-	utils.E(err)
+	pg := NewByDB(db)
+	pg.ConnStr = connStr
+	if dbName != "" {
+		pg.ConnStr = fmt.Sprintf(`%s dbname=%s`, connStr, dbName)
+	}
+	pg.Schema = schema
+	pg.Table = table
+	utils.E(pg.Init())
 
-	return NewByDB(db)
+	return pg
 }
 
-// NewByDB ...
+// NewByDB the table must exist, or call Init to create it
 func NewByDB(db *sql.DB) *PG {
 	return &PG{
 		db:           db,
+		Table:        "store",
 		PrefetchSize: 50,
+		BatchSize:    1000,
+		Prefix:       bucket.PrefixOf,
 	}
 }
 
-// Do ...
-func (pg *PG) Do(update bool, fn kvstore.DoTxn) error {
-	txn, err := pg.db.Begin()
+// Init create the schema and the table if they don't exist.
+// The table created by the old versions has no primary key, the duplicated keys in it will be removed,
+// only the physically last row of each key is kept, then the primary key will be added.
+func (pg *PG) Init() error {
+	if pg.Schema != "" {
+		_, err := pg.db.Exec(`CREATE SCHEMA IF NOT EXISTS ` + pq.QuoteIdentifier(pg.Schema))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := pg.db.Exec(`CREATE TABLE IF NOT EXISTS ` + pg.table() + ` (
+		key bytea PRIMARY KEY,
+		val bytea NOT NULL
+	)`)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		err = txn.Rollback()
-	}()
 
-	err = fn(&Txn{
-		db:  pg,
-		txn: txn,
+	legacy, err := pg.Legacy()
+	if err != nil || !legacy {
+		return err
+	}
+
+	return pg.Do(true, func(txn kvstore.Txn) error {
+		tx := txn.(*Txn).txn
+		for _, query := range []string{
+			`DELETE FROM %[1]s a USING %[1]s b WHERE a.key = b.key AND a.ctid < b.ctid`,
+			`UPDATE %[1]s SET val = '' WHERE val IS NULL`,
+			`ALTER TABLE %[1]s ALTER COLUMN val SET NOT NULL, ADD PRIMARY KEY (key)`,
+		} {
+			_, err := tx.Exec(fmt.Sprintf(query, pg.table()))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+}
+
+// Legacy returns true if the table is created by the old versions and has no primary key, Init will migrate it
+func (pg *PG) Legacy() (bool, error) {
+	var hasKey bool
+	err := pg.db.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM pg_index WHERE indrelid = $1::regclass AND indisprimary)`,
+		pg.table(),
+	).Scan(&hasKey)
+	return !hasKey, err
+}
+
+// table the quoted name of the table
+func (pg *PG) table() string {
+	if pg.Schema == "" {
+		return pq.QuoteIdentifier(pg.Table)
+	}
+	return pq.QuoteIdentifier(pg.Schema) + "." + pq.QuoteIdentifier(pg.Table)
+}
+
+// Do the transaction is read only if the update is false
+func (pg *PG) Do(update bool, fn kvstore.DoTxn) error {
+	txn, err := pg.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: !update})
 	if err != nil {
 		return err
 	}
 
-	if update {
-		return txn.Commit()
+	// the connection must be released even if the fn panics
+	defer func() {
+		if r := recover(); r != nil {
+			_ = txn.Rollback()
+			panic(r)
+		}
+	}()
+
+	t := &Txn{
+		db:      pg,
+		txn:     txn,
+		update:  update,
+		writes:  map[string][]byte{},
+		reads:   map[string][]byte{},
+		absent:  map[string]struct{}{},
+		changed: map[string]struct{}{},
+	}
+
+	err = fn(t)
+	if err == nil && update {
+		err = t.flush()
+	}
+	if err == nil && t.written {
+		err = t.check(nil)
 	}
-	return err
+	if err == nil && update {
+		err = t.notify()
+	}
+	if err != nil || !update {
+		rollbackErr := txn.Rollback()
+		if err == nil {
+			err = rollbackErr
+		}
+		return err
+	}
+
+	return txn.Commit()
 }
 
 // Close ...
 func (pg *PG) Close() error {
+	pg.stmts.Range(func(_, stmt interface{}) bool {
+		_ = stmt.(*sql.Stmt).Close()
+		return true
+	})
 	return pg.db.Close()
 }
 
+// stmt get the prepared statement of the query, the "%s" in the query will be replaced with the table
+func (pg *PG) stmt(query string) (*sql.Stmt, error) {
+	query = fmt.Sprintf(query, pg.table())
+
+	if stmt, has := pg.stmts.Load(query); has {
+		return stmt.(*sql.Stmt), nil
+	}
+
+	stmt, err := pg.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if prev, loaded := pg.stmts.LoadOrStore(query, stmt); loaded {
+		_ = stmt.Close()
+		return prev.(*sql.Stmt), nil
+	}
+	return stmt, nil
+}
+
 // Txn ...
 type Txn struct {
-	db  *PG
-	txn *sql.Tx
+	db     *PG
+	txn    *sql.Tx
+	update bool
+
+	// writes the buffered writes, the nil value means deletion
+	writes map[string][]byte
+
+	// written is true if anything is written by the transaction
+	written bool
+
+	// reads the values read via Get that haven't been checked, the nil value means the key doesn't exist
+	reads map[string][]byte
+
+	// absent the keys checked that didn't exist
+	absent map[string]struct{}
+
+	// cursors the number of the cursors declared, it's used to name the cursors
+	cursors int
+
+	// changed the prefixes of the changed keys to notify
+	changed map[string]struct{}
 }
 
 var _ kvstore.Txn = &Txn{}
 
+func (t *Txn) stmt(query string) (*sql.Stmt, error) {
+	stmt, err := t.db.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return t.txn.Stmt(stmt), nil
+}
+
 // Get ...
 func (t *Txn) Get(key []byte) ([]byte, error) {
-	var val []byte
-	err := t.txn.QueryRow(
-		"SELECT val FROM store WHERE key = $1",
-		key,
-	).Scan(&val)
+	if val, has := t.writes[string(key)]; has {
+		if val == nil {
+			return nil, kvstore.ErrKeyNotFound
+		}
+		return append([]byte{}, val...), nil
+	}
 
+	stmt, err := t.stmt(`SELECT val FROM %s WHERE key = $1`)
+	if err != nil {
+		return nil, err
+	}
+
+	var val []byte
+	err = stmt.QueryRow(key).Scan(&val)
 	if err == sql.ErrNoRows {
-		return nil, kvstore.ErrKeyNotFound
+		val, err = nil, kvstore.ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	} else if val == nil {
+		val = []byte{}
+	}
+
+	// only the first read matters
+	if _, has := t.reads[string(key)]; t.update && !has {
+		t.reads[string(key)] = val
 	}
 
 	return val, err
 }
 
-// Set ...
+// Set the writes are buffered, they are sent in batches before the reads that need them
 func (t *Txn) Set(key, value []byte) error {
-	_, err := t.txn.Exec(
-		`INSERT INTO store (key, val) VALUES ($1, $2)`,
-		key, value,
-	)
-	return err
+	return t.set(key, append([]byte{}, value...))
 }
 
 // Delete ...
 func (t *Txn) Delete(key []byte) error {
-	_, err := t.txn.Exec(
-		`DELETE FROM store WHERE key = $1`,
-		key,
-	)
-	return err
+	return t.set(key, nil)
 }
 
-func (t *Txn) getKeys(reverse bool, from []byte, keys *[][]byte) error {
-	var sql string
-	if reverse {
-		sql = `SELECT key FROM store WHERE key < $1 ORDER BY key DESC LIMIT $2`
-	} else {
-		sql = `SELECT key FROM store WHERE key > $1 ORDER BY key LIMIT $2`
+func (t *Txn) set(key, value []byte) error {
+	if !t.update {
+		return ErrReadOnly
+	}
+
+	t.writes[string(key)] = value
+	t.written = true
+	if t.db.Channel != "" {
+		t.changed[string(t.db.Prefix(key))] = struct{}{}
 	}
 
-	rows, err := t.txn.Query(sql, from, t.db.PrefetchSize)
+	if len(t.writes) >= t.db.BatchSize {
+		return t.flush()
+	}
+	return nil
+}
+
+// flush send the buffered writes, the keys read are checked before they are written
+func (t *Txn) flush() error {
+	if len(t.writes) == 0 {
+		return nil
+	}
+
+	err := t.check(t.writes)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		err = rows.Close()
-	}()
 
-	for rows.Next() {
-		var key []byte
-		err = rows.Scan(&key)
+	var keys, values, inserts, insertValues, deletes pq.ByteaArray
+	for key, val := range t.writes {
+		if val == nil {
+			deletes = append(deletes, []byte(key))
+		} else if _, has := t.absent[key]; has {
+			inserts = append(inserts, []byte(key))
+			insertValues = append(insertValues, val)
+			delete(t.absent, key)
+		} else {
+			keys = append(keys, []byte(key))
+			values = append(values, val)
+		}
+	}
+	t.writes = map[string][]byte{}
+
+	if len(inserts) > 0 {
+		stmt, err := t.stmt(`INSERT INTO %s (key, val) SELECT * FROM unnest($1::bytea[], $2::bytea[])
+			ON CONFLICT (key) DO NOTHING`)
+		if err != nil {
+			return err
+		}
+		res, err := stmt.Exec(inserts, insertValues)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if int(n) < len(inserts) {
+			return ErrConflict
+		}
+	}
+
+	if len(keys) > 0 {
+		stmt, err := t.stmt(`INSERT INTO %s (key, val) SELECT * FROM unnest($1::bytea[], $2::bytea[])
+			ON CONFLICT (key) DO UPDATE SET val = EXCLUDED.val`)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec(keys, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(deletes) > 0 {
+		stmt, err := t.stmt(`DELETE FROM %s WHERE key = ANY($1::bytea[])`)
 		if err != nil {
-			break
+			return err
+		}
+		_, err = stmt.Exec(deletes)
+		if err != nil {
+			return err
 		}
-		*keys = append(*keys, key)
 	}
 
-	return err
+	return nil
 }
 
-// Do ...
-func (t *Txn) Do(reverse bool, from []byte, fn kvstore.Iteratee) error {
-	_, err := t.Get(from)
-	if err == nil {
-		err = fn(from)
-		if err == kvstore.ErrStop {
-			return nil
+// check the values read are unchanged, if the only isn't nil only the keys in it are checked.
+// The rows checked are locked, so they can't be changed by others anymore.
+func (t *Txn) check(only map[string][]byte) error {
+	var keys pq.ByteaArray
+	for key := range t.reads {
+		if _, has := only[key]; only == nil || has {
+			keys = append(keys, []byte(key))
 		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	stmt, err := t.stmt(`SELECT key, val FROM %s WHERE key = ANY($1::bytea[]) FOR UPDATE`)
+	if err != nil {
+		return err
+	}
+	rows, err := stmt.Query(keys)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	latest := map[string][]byte{}
+	for rows.Next() {
+		var key, val []byte
+		err = rows.Scan(&key, &val)
 		if err != nil {
 			return err
 		}
-	} else if err != kvstore.ErrKeyNotFound {
+		latest[string(key)] = append([]byte{}, val...)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		read := t.reads[string(key)]
+		val, has := latest[string(key)]
+		if has != (read != nil) || !bytes.Equal(val, read) {
+			return ErrConflict
+		}
+		if !has {
+			t.absent[string(key)] = struct{}{}
+		}
+		delete(t.reads, string(key))
+	}
+	return nil
+}
+
+// Do the reverse iteration begins with the last key less than or equal to the from,
+// if the from is nil it begins with the last key. The iteration reads the snapshot when it begins,
+// the writes during the iteration are invisible to it.
+func (t *Txn) Do(reverse bool, from []byte, fn kvstore.Iteratee) error {
+	return t.iterate(reverse, from, false, func(key, _ []byte) error {
+		return fn(key)
+	})
+}
+
+// Iterate same as Do, but the values are fetched along with the keys, it saves the round trips of Get
+func (t *Txn) Iterate(reverse bool, from []byte, fn func(key, value []byte) error) error {
+	return t.iterate(reverse, from, true, fn)
+}
+
+// iterate via a server-side cursor, the keys are fetched in batches of the PrefetchSize
+func (t *Txn) iterate(reverse bool, from []byte, values bool, fn func(key, value []byte) error) error {
+	// the cursor should see the writes before the iteration
+	err := t.flush()
+	if err != nil {
 		return err
 	}
 
+	op, order := `>=`, `ASC`
+	if reverse {
+		op, order = `<=`, `DESC`
+	}
+
+	// the DECLARE doesn't accept parameters, the from is encoded as the hex format of bytea
+	where := `TRUE`
+	if from != nil {
+		where = fmt.Sprintf(`key %s '\x%x'::bytea`, op, from)
+	}
+
+	cols := `key`
+	if values {
+		cols = `key, val`
+	}
+
+	t.cursors++
+	name := fmt.Sprintf(`storer_cursor_%d`, t.cursors)
+
+	_, err = t.txn.Exec(fmt.Sprintf(
+		`DECLARE %s NO SCROLL CURSOR FOR SELECT %s FROM %s WHERE %s ORDER BY key %s`,
+		name, cols, t.db.table(), where, order,
+	))
+	if err != nil {
+		return err
+	}
+	defer func() { _, _ = t.txn.Exec(`CLOSE ` + name) }()
+
+	fetch := fmt.Sprintf(`FETCH FORWARD %d FROM %s`, t.db.PrefetchSize, name)
 	for {
-		var keys [][]byte
-		err := t.getKeys(reverse, from, &keys)
+		keys, vals, err := t.fetch(fetch, values)
 		if err != nil {
 			return err
 		}
 
-		for _, from = range keys {
-			err = fn(from)
+		for i, key := range keys {
+			var val []byte
+			if values {
+				val = vals[i]
+			}
+
+			err = fn(key, val)
 			if err == kvstore.ErrStop {
 				return nil
 			}
 			if err != nil {
-				break
+				return err
 			}
 		}
 
 		if len(keys) < t.db.PrefetchSize {
-			break
+			return nil
 		}
 	}
-	return nil
+}
+
+// fetch the next batch of the cursor, the rows must be closed before the fn uses the transaction
+func (t *Txn) fetch(query string, values bool) (keys, vals [][]byte, err error) {
+	rows, err := t.txn.Query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var key, val []byte
+		if values {
+			err = rows.Scan(&key, &val)
+		} else {
+			err = rows.Scan(&key)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		vals = append(vals, val)
+	}
+	return keys, vals, rows.Err()
 }
@@ -1,11 +1,13 @@
 package postgres_test
 
 import (
+	"database/sql"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ysmood/kit"
 	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/kvstore/kvtest"
 	"github.com/ysmood/storer/pkg/postgres"
 )
 
@@ -58,3 +60,142 @@ func TestIteration(t *testing.T) {
 	assert.Len(t, list, 100)
 	assert.Equal(t, []byte{99}, list[99])
 }
+
+func TestReadOnly(t *testing.T) {
+	err := db.Do(false, func(txn kvstore.Txn) error {
+		return txn.Set([]byte("key"), nil)
+	})
+	assert.Equal(t, postgres.ErrReadOnly, err)
+}
+
+func TestIterateValues(t *testing.T) {
+	clean()
+
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		for i := 0; i < 120; i++ {
+			kit.E(txn.Set([]byte{byte(i)}, []byte{byte(i)}))
+		}
+
+		count := 0
+		err := txn.(*postgres.Txn).Iterate(true, []byte{100}, func(key, value []byte) error {
+			assert.Equal(t, key, value)
+			count++
+			return nil
+		})
+		assert.Equal(t, 101, count)
+		return err
+	}))
+}
+
+func TestTable(t *testing.T) {
+	custom := postgres.NewWithTable("", "storer", "kv")
+
+	kit.E(custom.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Set([]byte("key"), []byte("a")))
+		return txn.Set([]byte("key"), []byte("b"))
+	}))
+
+	kit.E(custom.Do(false, func(txn kvstore.Txn) error {
+		val, err := txn.Get([]byte("key"))
+		kit.E(err)
+		assert.Equal(t, []byte("b"), val)
+		return nil
+	}))
+
+	// init is idempotent
+	kit.E(custom.Init())
+	legacy, err := custom.Legacy()
+	kit.E(err)
+	assert.False(t, legacy)
+
+	// the table created by the old versions
+	raw, err := sql.Open("postgres", custom.ConnStr)
+	kit.E(err)
+	_, err = raw.Exec(`CREATE TABLE storer.legacy (key bytea, val bytea)`)
+	kit.E(err)
+	old := postgres.NewByDB(raw)
+	old.Schema, old.Table = "storer", "legacy"
+	legacy, err = old.Legacy()
+	kit.E(err)
+	assert.True(t, legacy)
+	kit.E(old.Init())
+	legacy, err = old.Legacy()
+	kit.E(err)
+	assert.False(t, legacy)
+
+	kit.E(old.Close())
+	kit.E(custom.Close())
+}
+
+func TestNotify(t *testing.T) {
+	writer := postgres.New("")
+	writer.Channel = "storer_test"
+
+	// another process sharing the same database
+	reader := postgres.New(writer.ConnStr)
+	reader.Channel = writer.Channel
+
+	received := make(chan [][]byte, 1)
+	stop, err := reader.Notify(func(prefixes [][]byte) {
+		received <- prefixes
+	})
+	kit.E(err)
+	defer func() { kit.E(stop()) }()
+
+	kit.E(writer.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Set([]byte{1, 'a'}, nil))
+		kit.E(txn.Set([]byte{1, 'b'}, nil))
+		return txn.Delete([]byte{2, 'a'})
+	}))
+
+	assert.Equal(t, [][]byte{{1}, {2}}, <-received)
+
+	_, err = db.Notify(func([][]byte) {})
+	assert.Equal(t, postgres.ErrNoChannel, err)
+}
+
+func TestConflict(t *testing.T) {
+	clean()
+	set := func(key, value string) {
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			return txn.Set([]byte(key), []byte(value))
+		}))
+	}
+	set("a", "1")
+
+	// the writes of others to the keys not read don't conflict
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("a"))
+		kit.E(err)
+
+		set("b", "2")
+
+		return txn.Set([]byte("a"), []byte("3"))
+	}))
+
+	// the missing key read is inserted by others
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("c"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+
+		set("c", "")
+
+		return txn.Set([]byte("c"), []byte("4"))
+	})
+	assert.Equal(t, postgres.ErrConflict, err)
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		value, err := txn.Get([]byte("c"))
+		kit.E(err)
+		assert.Equal(t, []byte{}, value)
+		return nil
+	}))
+}
+
+func TestSuite(t *testing.T) {
+	kvtest.Suite{
+		Open:          func() kvstore.Store { return postgres.New("") },
+		Conflict:      postgres.ErrConflict,
+		ReadCommitted: true,
+	}.Run(t)
+}
@@ -0,0 +1,217 @@
+// Package redis is the adapter for the servers that speak the Redis protocol.
+//
+// The keys are the members of a sorted set with the same score, so they are ordered byte-wise and can be
+// iterated via ZRANGEBYLEX. Each value is stored in its own Redis key, so that it can be watched alone.
+package redis
+
+import (
+	"errors"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// ErrConflict the update transaction read a key that was changed by another transaction committed after
+// the read, the transaction is discarded, retry it if needed
+var ErrConflict = errors.New("[storer.redis] transaction conflict")
+
+// ErrReadOnly write in a read transaction
+var ErrReadOnly = errors.New("[storer.redis] transaction is read only")
+
+// Redis adapter. The native TTL isn't supported, storer will track the expiry by itself.
+//
+// The reads see the latest committed data. An update transaction holds a connection, each key it reads
+// via Get is watched by WATCH on that connection, and the buffered writes are committed by MULTI/EXEC,
+// so ErrConflict will be returned if any key read has been changed since the read. The keys seen by the
+// iteration aren't watched, the isolation level is read committed.
+type Redis struct {
+	pool *redigo.Pool
+
+	// keys the name of the sorted set for the keys, values the prefix of the Redis keys for the values
+	keys, values string
+
+	// PrefetchSize by default each time 50 keys will be fetched
+	PrefetchSize int
+}
+
+var _ kvstore.Store = &Redis{}
+
+// New a helper to create an adapter instance, the Redis keys will be prefixed with "storer:"
+func New(addr string) *Redis {
+	return NewByPool(&redigo.Pool{
+		MaxIdle: 8,
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", addr)
+		},
+	}, "storer:")
+}
+
+// NewByPool the prefix is used to name the Redis keys, so that multiple stores can share the same server
+func NewByPool(pool *redigo.Pool, prefix string) *Redis {
+	return &Redis{
+		pool:         pool,
+		keys:         prefix + "keys",
+		values:       prefix + "values:",
+		PrefetchSize: 50,
+	}
+}
+
+// Do ...
+func (r *Redis) Do(update bool, fn kvstore.DoTxn) error {
+	txn := &Txn{db: r}
+	if update {
+		// the pool will UNWATCH the connection when it's put back
+		txn.conn = r.pool.Get()
+		defer func() { _ = txn.conn.Close() }()
+
+		txn.writes = map[string][]byte{}
+	}
+
+	err := fn(txn)
+	if err != nil || len(txn.writes) == 0 {
+		return err
+	}
+
+	return txn.commit()
+}
+
+// Close ...
+func (r *Redis) Close() error {
+	return r.pool.Close()
+}
+
+func (r *Redis) do(cmd string, args ...interface{}) (interface{}, error) {
+	conn := r.pool.Get()
+	defer func() { _ = conn.Close() }()
+	return conn.Do(cmd, args...)
+}
+
+// the Redis key of the value
+func (r *Redis) value(key []byte) string {
+	return r.values + string(key)
+}
+
+// Txn ...
+type Txn struct {
+	db *Redis
+
+	// conn the connection that watches the keys read, it's nil for the read transactions
+	conn redigo.Conn
+
+	// writes the buffered writes, the nil value means deletion
+	writes map[string][]byte
+}
+
+var _ kvstore.Txn = &Txn{}
+
+// Get ...
+func (t *Txn) Get(key []byte) ([]byte, error) {
+	if val, has := t.writes[string(key)]; has {
+		if val == nil {
+			return nil, kvstore.ErrKeyNotFound
+		}
+		return append([]byte{}, val...), nil
+	}
+
+	var val []byte
+	var err error
+	if t.conn == nil {
+		val, err = redigo.Bytes(t.db.do("GET", t.db.value(key)))
+	} else {
+		// watch before the read, so that any change after the read will fail the EXEC
+		_, err = t.conn.Do("WATCH", t.db.value(key))
+		if err != nil {
+			return nil, err
+		}
+		val, err = redigo.Bytes(t.conn.Do("GET", t.db.value(key)))
+	}
+
+	if err == redigo.ErrNil {
+		return nil, kvstore.ErrKeyNotFound
+	}
+	return val, err
+}
+
+// Set ...
+func (t *Txn) Set(key, value []byte) error {
+	return t.set(key, append([]byte{}, value...))
+}
+
+// Delete ...
+func (t *Txn) Delete(key []byte) error {
+	return t.set(key, nil)
+}
+
+func (t *Txn) set(key, value []byte) error {
+	if t.writes == nil {
+		return ErrReadOnly
+	}
+	t.writes[string(key)] = value
+	return nil
+}
+
+func (t *Txn) commit() error {
+	err := t.conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	for key, val := range t.writes {
+		if val == nil {
+			err = t.conn.Send("DEL", t.db.value([]byte(key)))
+			if err == nil {
+				err = t.conn.Send("ZREM", t.db.keys, key)
+			}
+		} else {
+			err = t.conn.Send("SET", t.db.value([]byte(key)), val)
+			if err == nil {
+				err = t.conn.Send("ZADD", t.db.keys, 0, key)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := redigo.Values(t.conn.Do("EXEC"))
+	// the EXEC is aborted if any watched key has been changed
+	if err == redigo.ErrNil {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	for _, r := range res {
+		if err, ok := r.(redigo.Error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do the reverse iteration begins with the last key less than or equal to the from,
+// if the from is nil it begins with the last key. The keys are fetched in batches, each batch
+// is merged with the writes of the transaction when it's fetched.
+func (t *Txn) Do(reverse bool, from []byte, fn kvstore.Iteratee) error {
+	return kvstore.Prefetch(t.db.PrefetchSize, t.writes, reverse, from, t.fetch, fn)
+}
+
+// fetch the next batch of keys after the from in the iteration order
+func (t *Txn) fetch(reverse bool, from []byte, inclusive bool) ([][]byte, error) {
+	bound := []byte("-")
+	if reverse {
+		bound = []byte("+")
+	}
+	if from != nil {
+		bound = []byte("(")
+		if inclusive {
+			bound = []byte("[")
+		}
+		bound = append(bound, from...)
+	}
+
+	if reverse {
+		return redigo.ByteSlices(t.db.do("ZREVRANGEBYLEX", t.db.keys, bound, "-", "LIMIT", 0, t.db.PrefetchSize))
+	}
+	return redigo.ByteSlices(t.db.do("ZRANGEBYLEX", t.db.keys, bound, "+", "LIMIT", 0, t.db.PrefetchSize))
+}
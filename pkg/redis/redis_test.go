@@ -0,0 +1,125 @@
+package redis_test
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/kvstore/kvtest"
+	"github.com/ysmood/storer/pkg/redis"
+)
+
+func newRedis(t *testing.T) *redis.Redis {
+	return redis.New(miniredis.RunT(t).Addr())
+}
+
+func set(db kvstore.Store, kvs ...string) {
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		for i := 0; i < len(kvs); i += 2 {
+			err := txn.Set([]byte(kvs[i]), []byte(kvs[i+1]))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func keys(txn kvstore.Txn, reverse bool, from []byte) string {
+	s := ""
+	kit.E(txn.Do(reverse, from, func(key []byte) error {
+		s += string(key)
+		return nil
+	}))
+	return s
+}
+
+func TestPrefetch(t *testing.T) {
+	db := newRedis(t)
+	db.PrefetchSize = 2
+	set(db, "b", "", "d", "", "a", "", "c", "", "e", "")
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		assert.Equal(t, "abcde", keys(txn, false, nil))
+		assert.Equal(t, "cde", keys(txn, false, []byte("bb")))
+		assert.Equal(t, "edcba", keys(txn, true, nil))
+		assert.Equal(t, "ba", keys(txn, true, []byte("bb")))
+		return nil
+	}))
+
+	// the writes are merged into each batch
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Set([]byte("bb"), nil))
+		kit.E(txn.Set([]byte("f"), nil))
+		kit.E(txn.Delete([]byte("c")))
+		kit.E(txn.Delete([]byte("d")))
+
+		assert.Equal(t, "abbbef", keys(txn, false, nil))
+		assert.Equal(t, "bbef", keys(txn, false, []byte("b0")))
+		assert.Equal(t, "febbba", keys(txn, true, nil))
+		assert.Equal(t, "bbba", keys(txn, true, []byte("d")))
+		return nil
+	}))
+}
+
+func TestConflict(t *testing.T) {
+	db := newRedis(t)
+	set(db, "a", "1")
+
+	// the writes of others to the keys not read don't conflict
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("a"))
+		kit.E(err)
+
+		set(db, "b", "2")
+
+		return txn.Set([]byte("a"), []byte("3"))
+	}))
+
+	// the key deleted and set again by others
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("c"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+
+		set(db, "c", "")
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			return txn.Delete([]byte("c"))
+		}))
+
+		return txn.Set([]byte("c"), []byte("4"))
+	})
+	assert.Equal(t, redis.ErrConflict, err)
+}
+
+func TestDeleteLeavesNothing(t *testing.T) {
+	s := miniredis.RunT(t)
+	db := redis.New(s.Addr())
+
+	for i := 0; i < 10; i++ {
+		set(db, "a", "1", "b", "2")
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			_, _ = txn.Get([]byte("a"))
+			kit.E(txn.Delete([]byte("a")))
+			return txn.Delete([]byte("b"))
+		}))
+	}
+
+	assert.Empty(t, s.Keys())
+}
+
+func TestReadOnly(t *testing.T) {
+	err := newRedis(t).Do(false, func(txn kvstore.Txn) error {
+		return txn.Set([]byte("k"), nil)
+	})
+	assert.Equal(t, redis.ErrReadOnly, err)
+}
+
+func TestSuite(t *testing.T) {
+	kvtest.Suite{
+		Open:          func() kvstore.Store { return newRedis(t) },
+		Conflict:      redis.ErrConflict,
+		ReadCommitted: true,
+	}.Run(t)
+}
@@ -0,0 +1,178 @@
+// Package shard spreads the keys of a kvstore.Store across multiple stores.
+//
+// By default the keys are routed by their buckets, a collection, its indexes, its id sequence and its
+// expiry index are kept in the same store, so that the common transactions of storer only touch one store and stay atomic.
+// An update transaction that writes multiple stores returns ErrCrossShard, unless the NonAtomic is set.
+package shard
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// ErrCrossShard the update transaction writes the keys of multiple stores, it can't be atomic.
+// Nothing is written, set the NonAtomic to commit the stores one by one.
+var ErrCrossShard = errors.New("[storer.shard] the transaction writes multiple stores, it can't be atomic")
+
+// Shard the store that routes each key to one of the stores
+type Shard struct {
+	stores []kvstore.Store
+
+	// Route get the index of the store for the key. If it's nil the keys are routed by their buckets,
+	// the names of the buckets are always in the first store. A bucket stays in the store that has its keys,
+	// so the rename won't move it. A bucket without keys is routed by the hash of its group, or to the
+	// store of the group bucket if it exists. The keys that aren't in a named bucket are routed by the
+	// hash of their prefixes.
+	Route func(key []byte) (int, error)
+
+	// Group get the group of a bucket name when the Route is nil, the buckets of the same group are in the same store.
+	// If it returns nil the bucket is in the first store with the names. By default it's GroupByCollection.
+	Group func(name []byte) []byte
+
+	// NonAtomic if it's true an update transaction can write multiple stores, each store is committed
+	// in the order of the indexes, if one of them fails the stores committed before it won't be rolled back
+	NonAtomic bool
+
+	// routes the cached store index of each bucket prefix that has committed keys
+	routes sync.Map
+
+	lock sync.Mutex
+
+	// names the cached name of each bucket prefix
+	names map[string][]byte
+}
+
+var _ kvstore.Store = &Shard{}
+
+// New the order of the stores must not change, or the keys will be routed to the wrong stores
+func New(stores ...kvstore.Store) *Shard {
+	return &Shard{
+		stores: stores,
+		Group:  GroupByCollection,
+		names:  map[string][]byte{},
+	}
+}
+
+// Do the transaction of a store begins when the transaction first uses the store, so the stores
+// may be read from different points in time. The conflicts are detected by each store independently.
+func (s *Shard) Do(update bool, fn kvstore.DoTxn) error {
+	txn := &Txn{shard: s, update: update, txns: map[int]*storeTxn{}, routes: map[string]int{}}
+
+	// the transactions of the stores must be released even if the fn panics
+	defer func() {
+		if r := recover(); r != nil {
+			_ = txn.end(errAbort)
+			panic(r)
+		}
+	}()
+
+	err := fn(txn)
+	if err != nil {
+		_ = txn.end(errAbort)
+		return err
+	}
+	return txn.end(nil)
+}
+
+// Close close all the stores that have the Close method, the first error is returned
+func (s *Shard) Close() error {
+	var err error
+	for _, store := range s.stores {
+		if c, ok := store.(interface{ Close() error }); ok {
+			if e := c.Close(); err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// ByKey route by the hash of the whole key, the keys spread evenly, but most update transactions of
+// storer will write multiple stores. Use it as the Route:
+//
+//	db.Route = db.ByKey
+func (s *Shard) ByKey(key []byte) (int, error) {
+	return s.hash(key), nil
+}
+
+// GroupByCollection the indexes, the id sequence and the expiry index of a collection are in the group of
+// the collection, such as "db:anchor:users:index:email" is in the group "db:anchor:users". The buckets of
+// the store itself, such as "db:schema", are updated together, they are in the first store.
+func GroupByCollection(name []byte) []byte {
+	if bytes.Count(name, []byte(":")) < 2 {
+		return nil
+	}
+	for _, sep := range [][]byte{[]byte(":index:"), []byte(":rindex:")} {
+		if i := bytes.LastIndex(name, sep); i >= 0 {
+			return name[:i]
+		}
+	}
+	for _, suffix := range [][]byte{[]byte(":sequence"), []byte(":expiry")} {
+		if bytes.HasSuffix(name, suffix) {
+			return name[:len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+func (s *Shard) hash(data []byte) int {
+	h := fnv.New32a()
+	_, _ = h.Write(data)
+	return int(h.Sum32() % uint32(len(s.stores)))
+}
+
+// locate find the store that has the committed keys of the bucket prefix
+func (s *Shard) locate(prefix []byte) (int, bool, error) {
+	for i, store := range s.stores {
+		found := false
+		err := store.Do(false, func(txn kvstore.Txn) error {
+			return txn.Do(false, prefix, func(key []byte) error {
+				found = bytes.HasPrefix(key, prefix)
+				return kvstore.ErrStop
+			})
+		})
+		if err != nil || found {
+			return i, found, err
+		}
+	}
+	return 0, false, nil
+}
+
+// name get the committed name of the bucket prefix, nil if the prefix has no name
+func (s *Shard) name(prefix []byte) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if name, has := s.names[string(prefix)]; has {
+		return name, nil
+	}
+
+	// the bucket may be created after the last load
+	err := s.stores[0].Do(false, func(txn kvstore.Txn) error {
+		return loadNames(txn, s.names)
+	})
+
+	return s.names[string(prefix)], err
+}
+
+// loadNames load the names of the bucket prefixes into the dict
+func loadNames(txn kvstore.Txn, dict map[string][]byte) error {
+	names, err := bucket.Names(txn)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		b, err := bucket.Lookup(txn, name)
+		if err != nil {
+			return err
+		}
+		dict[string(b.Prefix(nil))] = name
+	}
+	return nil
+}
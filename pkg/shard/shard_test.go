@@ -0,0 +1,258 @@
+package shard_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/kvstore/kvtest"
+	"github.com/ysmood/storer/pkg/memory"
+	"github.com/ysmood/storer/pkg/shard"
+)
+
+func keys(txn kvstore.Txn, reverse bool, from []byte) []string {
+	list := []string{}
+	kit.E(txn.Do(reverse, from, func(key []byte) error {
+		list = append(list, string(key))
+		return nil
+	}))
+	return list
+}
+
+func count(db kvstore.Store) int {
+	n := 0
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		n = len(keys(txn, false, nil))
+		return nil
+	}))
+	return n
+}
+
+func TestMerge(t *testing.T) {
+	stores := []kvstore.Store{memory.New(), memory.New(), memory.New()}
+	db := shard.New(stores...)
+	db.Route = db.ByKey
+	db.NonAtomic = true
+
+	expected := []string{}
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("%02d", i)
+			expected = append(expected, key)
+			kit.E(txn.Set([]byte(key), nil))
+		}
+		return nil
+	}))
+
+	// the keys are spread
+	for _, s := range stores {
+		assert.NotZero(t, count(s))
+	}
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		assert.Equal(t, expected, keys(txn, false, nil))
+		assert.Equal(t, expected[50:], keys(txn, false, []byte("50")))
+		assert.Equal(t, "49", keys(txn, true, []byte("49x"))[0])
+		assert.Len(t, keys(txn, true, nil), 100)
+
+		n := 0
+		kit.E(txn.Do(true, nil, func(key []byte) error {
+			n++
+			if n == 3 {
+				return kvstore.ErrStop
+			}
+			return nil
+		}))
+		assert.Equal(t, 3, n)
+		return nil
+	}))
+
+	// delete during the merged iteration
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		return txn.Do(false, nil, func(key []byte) error {
+			return txn.Delete(key)
+		})
+	}))
+	assert.Equal(t, 0, count(db))
+}
+
+func TestCrossShard(t *testing.T) {
+	db := shard.New(memory.New(), memory.New())
+	db.Route = func(key []byte) (int, error) {
+		return int(key[0] % 2), nil
+	}
+
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Set([]byte("a"), nil))
+		kit.E(txn.Set([]byte("c"), nil))
+		return txn.Set([]byte("b"), nil)
+	})
+	assert.Equal(t, shard.ErrCrossShard, err)
+	assert.Equal(t, 0, count(db))
+
+	// reading multiple stores is fine
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("b"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+		return txn.Set([]byte("a"), nil)
+	}))
+
+	db.NonAtomic = true
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Set([]byte("b"), nil))
+		return txn.Set([]byte("c"), nil)
+	}))
+	assert.Equal(t, 3, count(db))
+}
+
+type Note struct {
+	Text string
+}
+
+func TestStorer(t *testing.T) {
+	stores := []kvstore.Store{memory.New(), memory.New(), memory.New(), memory.New()}
+	store := storer.NewWithDB("", shard.New(stores...))
+
+	for i := 0; i < 4; i++ {
+		notes := store.ListWithName(fmt.Sprintf("notes%d", i), &Note{})
+		index := notes.Index("text", func(n *Note) interface{} {
+			return n.Text
+		})
+
+		_, err := notes.Add(&Note{"a"})
+		kit.E(err)
+		id, err := notes.Add(&Note{"b"})
+		kit.E(err)
+		kit.E(notes.Del(id))
+
+		var n Note
+		kit.E(index.From("a").Find(&n))
+		assert.Equal(t, "a", n.Text)
+		assert.Equal(t, storer.ErrNotFound, index.From("b").Find(&n))
+
+		// the data stays in the same store after the rename
+		kit.E(notes.Rename(fmt.Sprintf("renamed%d", i)))
+		kit.E(index.From("a").Find(&n))
+		_, err = notes.Add(&Note{"c"})
+		kit.E(err)
+	}
+
+	// each collection with its indexes and sequence is in one store
+	prefixes := map[string]int{}
+	for i, s := range stores {
+		kit.E(s.Do(false, func(txn kvstore.Txn) error {
+			return txn.Do(false, nil, func(key []byte) error {
+				prefixes[string(bucket.PrefixOf(key))] = i
+				return nil
+			})
+		}))
+	}
+
+	groups := map[string]int{}
+	used := map[int]bool{}
+	kit.E(stores[0].Do(false, func(txn kvstore.Txn) error {
+		names, err := bucket.Names(txn)
+		kit.E(err)
+
+		for _, name := range names {
+			b, err := bucket.Lookup(txn, name)
+			kit.E(err)
+			i, has := prefixes[string(b.Prefix(nil))]
+			group := shard.GroupByCollection(name)
+			if !has || !bytes.Contains(group, []byte(":renamed")) {
+				continue
+			}
+			if g, has := groups[string(group)]; has {
+				assert.Equal(t, g, i, string(name))
+			}
+			groups[string(group)] = i
+			used[i] = true
+		}
+		return nil
+	}))
+	assert.Len(t, groups, 4)
+	assert.Greater(t, len(used), 1)
+
+	kit.E(store.Close())
+}
+
+func TestTTL(t *testing.T) {
+	stores := []kvstore.Store{memory.New(), memory.New(), memory.New(), memory.New()}
+	db := shard.New(stores...)
+	store := storer.NewWithDB("", db)
+
+	// the shard doesn't support the native TTL, the expiry is tracked by storer
+	total := func() int {
+		n := 0
+		for _, s := range stores {
+			n += count(s)
+		}
+		return n
+	}
+
+	lists := []*storer.List{}
+	indexes := []*storer.Index{}
+	for i := 0; i < 8; i++ {
+		notes := store.ListWithName(fmt.Sprintf("notes%d", i), &Note{})
+		indexes = append(indexes, notes.Index("text", func(n *Note) interface{} {
+			return n.Text
+		}))
+		lists = append(lists, notes)
+
+		// create the expiry index
+		_, err := notes.AddWithTTL(&Note{}, time.Nanosecond)
+		kit.E(err)
+	}
+	time.Sleep(time.Millisecond)
+	kit.E(store.Sweep())
+	before := total()
+
+	for i, notes := range lists {
+		_, err := notes.AddWithTTL(&Note{"a"}, 50*time.Millisecond)
+		kit.E(err)
+		_, err = notes.Add(&Note{"b"})
+		kit.E(err)
+
+		// the expiry index is moved with the list
+		if i%2 == 0 {
+			kit.E(notes.Rename(fmt.Sprintf("renamed%d", i)))
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	kit.E(store.Sweep())
+
+	for _, index := range indexes {
+		var n Note
+		assert.Equal(t, storer.ErrNotFound, index.From("a").Find(&n))
+		kit.E(index.From("b").Find(&n))
+	}
+
+	// only the items b and their index entries are left
+	assert.Equal(t, before+8*3, total())
+	kit.E(store.Close())
+}
+
+func TestSuite(t *testing.T) {
+	kvtest.Suite{
+		Open: func() kvstore.Store {
+			db := shard.New(memory.New(), memory.New(), memory.New())
+
+			// the keys of the same transaction in the suite are in the same store
+			db.Route = func(key []byte) (int, error) {
+				if len(key) > 0 && key[0] >= '0' && key[0] <= '9' {
+					return 1, nil
+				}
+				return 0, nil
+			}
+			return db
+		},
+		Conflict: memory.ErrConflict,
+	}.Run(t)
+}
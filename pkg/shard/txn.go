@@ -0,0 +1,340 @@
+package shard
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// errAbort discard the transaction of a store
+var errAbort = errors.New("[storer.shard] abort")
+
+// Txn ...
+type Txn struct {
+	shard  *Shard
+	update bool
+
+	// txns the transactions of the stores used, the key is the index of the store
+	txns map[int]*storeTxn
+
+	// routes the store index of each bucket prefix that has no committed keys yet
+	routes map[string]int
+}
+
+var _ kvstore.Txn = &Txn{}
+
+// storeTxn the transaction of a store, it runs in its own goroutine until it ends,
+// so that the transactions of multiple stores can be used at the same time
+type storeTxn struct {
+	txn kvstore.Txn
+
+	// done send the result of the transaction to end it
+	done chan error
+
+	// result the error returned by the Do of the store
+	result chan error
+
+	written bool
+}
+
+// Get ...
+func (t *Txn) Get(key []byte) ([]byte, error) {
+	i, err := t.route(key)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := t.open(i)
+	if err != nil {
+		return nil, err
+	}
+	return st.txn.Get(key)
+}
+
+// Set ...
+func (t *Txn) Set(key, value []byte) error {
+	st, err := t.write(key)
+	if err != nil {
+		return err
+	}
+	return st.txn.Set(key, value)
+}
+
+// Delete ...
+func (t *Txn) Delete(key []byte) error {
+	st, err := t.write(key)
+	if err != nil {
+		return err
+	}
+	return st.txn.Delete(key)
+}
+
+func (t *Txn) write(key []byte) (*storeTxn, error) {
+	i, err := t.route(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.update && !t.shard.NonAtomic {
+		for j, st := range t.txns {
+			if st.written && j != i {
+				return nil, ErrCrossShard
+			}
+		}
+	}
+
+	st, err := t.open(i)
+	if err != nil {
+		return nil, err
+	}
+	st.written = t.update
+	return st, nil
+}
+
+// route get the index of the store for the key
+func (t *Txn) route(key []byte) (int, error) {
+	s := t.shard
+	if s.Route != nil {
+		return s.Route(key)
+	}
+	if len(s.stores) == 1 || bucket.InNameMap(key) {
+		return 0, nil
+	}
+
+	prefix := bucket.PrefixOf(key)
+	if i, has := s.routes.Load(string(prefix)); has {
+		return i.(int), nil
+	}
+	if i, has := t.routes[string(prefix)]; has {
+		return i, nil
+	}
+
+	i, found, err := s.locate(prefix)
+	if err != nil {
+		return 0, err
+	}
+	if found {
+		s.routes.Store(string(prefix), i)
+		return i, nil
+	}
+
+	// the route may depend on the names written by the transaction, it's only cached by the transaction
+	i, err = t.assign(prefix)
+	if err != nil {
+		return 0, err
+	}
+	t.routes[string(prefix)] = i
+	return i, nil
+}
+
+// assign a store to the bucket prefix that has no keys
+func (t *Txn) assign(prefix []byte) (int, error) {
+	s := t.shard
+
+	name, err := s.name(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	// the bucket may be created by the transaction
+	st, err := t.open(0)
+	if err != nil {
+		return 0, err
+	}
+	if name == nil {
+		names := map[string][]byte{}
+		err = loadNames(st.txn, names)
+		if err != nil {
+			return 0, err
+		}
+		name = names[string(prefix)]
+	}
+
+	// the key isn't in a named bucket
+	if name == nil {
+		return s.hash(prefix), nil
+	}
+
+	group := s.Group(name)
+	if group == nil {
+		return 0, nil
+	}
+	if !bytes.Equal(group, name) {
+		b, err := bucket.Lookup(st.txn, group)
+		if err == nil {
+			return t.route(b.Prefix(nil))
+		} else if err != kvstore.ErrKeyNotFound {
+			return 0, err
+		}
+	}
+
+	return s.hash(group), nil
+}
+
+// open begin the transaction of the store if it's not begun
+func (t *Txn) open(i int) (*storeTxn, error) {
+	if st, has := t.txns[i]; has {
+		return st, nil
+	}
+
+	st := &storeTxn{done: make(chan error), result: make(chan error, 1)}
+	ready := make(chan kvstore.Txn)
+
+	go func() {
+		st.result <- t.shard.stores[i].Do(t.update, func(txn kvstore.Txn) error {
+			ready <- txn
+			return <-st.done
+		})
+	}()
+
+	select {
+	case st.txn = <-ready:
+	case err := <-st.result:
+		return nil, err
+	}
+
+	t.txns[i] = st
+	return st, nil
+}
+
+// end the transactions of the stores, if the err is nil the written stores are committed first,
+// once a commit fails the rest are discarded
+func (t *Txn) end(err error) error {
+	list := make([]int, 0, len(t.txns))
+	for i := range t.txns {
+		list = append(list, i)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		if t.txns[list[a]].written != t.txns[list[b]].written {
+			return t.txns[list[a]].written
+		}
+		return list[a] < list[b]
+	})
+
+	for _, i := range list {
+		st := t.txns[i]
+		if err == nil {
+			st.done <- nil
+			err = <-st.result
+		} else {
+			st.done <- errAbort
+			<-st.result
+		}
+	}
+	return err
+}
+
+// Do the keys of all the stores are merged in order
+func (t *Txn) Do(reverse bool, from []byte, fn kvstore.Iteratee) error {
+	if len(t.shard.stores) == 1 {
+		st, err := t.open(0)
+		if err != nil {
+			return err
+		}
+		return st.txn.Do(reverse, from, fn)
+	}
+
+	cursors := []*cursor{}
+	defer func() {
+		for _, c := range cursors {
+			c.stop()
+		}
+	}()
+
+	for i := range t.shard.stores {
+		st, err := t.open(i)
+		if err != nil {
+			return err
+		}
+		c := iterate(st.txn, reverse, from)
+		cursors = append(cursors, c)
+		if c.key == nil && c.err != nil {
+			return c.err
+		}
+	}
+
+	for {
+		var next *cursor
+		for _, c := range cursors {
+			if c.key == nil {
+				continue
+			}
+			if next == nil {
+				next = c
+				continue
+			}
+			cmp := bytes.Compare(c.key, next.key)
+			if (!reverse && cmp < 0) || (reverse && cmp > 0) {
+				next = c
+			}
+		}
+		if next == nil {
+			return nil
+		}
+
+		err := fn(next.key)
+		if err == kvstore.ErrStop {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = next.next()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cursor iterate a store in its own goroutine, the iteration of the store is paused at the current key
+// until the next is called, so the iteratee of the store won't return before its key is used
+type cursor struct {
+	keys  chan []byte
+	reply chan error
+
+	// key the current key, it's nil if the iteration ended
+	key []byte
+
+	// err the error of the iteration, it's set before the keys is closed
+	err error
+}
+
+func iterate(txn kvstore.Txn, reverse bool, from []byte) *cursor {
+	c := &cursor{keys: make(chan []byte), reply: make(chan error)}
+
+	go func() {
+		c.err = txn.Do(reverse, from, func(key []byte) error {
+			c.keys <- append([]byte{}, key...)
+			return <-c.reply
+		})
+		close(c.keys)
+	}()
+
+	c.key = <-c.keys
+	return c
+}
+
+// next resume the iteration to get the next key
+func (c *cursor) next() error {
+	c.reply <- nil
+	c.key = <-c.keys
+	if c.key == nil {
+		return c.err
+	}
+	return nil
+}
+
+// stop the iteration if it's not ended
+func (c *cursor) stop() {
+	if c.key == nil {
+		return
+	}
+	c.key = nil
+	c.reply <- kvstore.ErrStop
+	for range c.keys {
+	}
+}
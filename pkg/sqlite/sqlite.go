@@ -0,0 +1,314 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/ysmood/kit/pkg/utils"
+	"github.com/ysmood/storer/pkg/kvstore"
+
+	_ "modernc.org/sqlite" // pure go sqlite driver
+)
+
+// ErrReadOnly write in a read transaction
+var ErrReadOnly = errors.New("[storer.sqlite] transaction is read only")
+
+// ErrConflict the update transaction read a key that was changed by another transaction committed after
+// the transaction began, the transaction is discarded, retry it if needed
+var ErrConflict = errors.New("[storer.sqlite] transaction conflict")
+
+// SQLite adapter, the data is stored in the table "store", it can be inspected via the sqlite3 shell.
+//
+// The database must be in the WAL mode, so that the readers and the writer won't block each other.
+// SQLite only allows one writer at a time, but storer may begin an update transaction inside another one,
+// such as to allocate ids or to create buckets. So an update transaction reads from the snapshot when it
+// begins, the writes are kept in the temp table "writes" of its connection, and they are written to the
+// "store" by a short write transaction when the fn returns. The values read via Get are kept in the temp
+// table "reads", the write transaction compares them with the latest ones before the writes, if any of them
+// has been changed ErrConflict will be returned.
+type SQLite struct {
+	db *sql.DB
+
+	// PrefetchSize by default each time 50 keys will be fetched
+	PrefetchSize int
+}
+
+var _ kvstore.Store = &SQLite{}
+
+// New a helper to create an adapter instance.
+// If the path is empty a tmp file will be created.
+func New(path string) *SQLite {
+	if path == "" {
+		path = filepath.Join("tmp", utils.RandString(10)+".db")
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0775)
+	utils.E(err)
+
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)")
+	utils.E(err)
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS store (
+			key BLOB PRIMARY KEY,
+			val BLOB NOT NULL
+		) WITHOUT ROWID;
+	`)
+	utils.E(err)
+
+	return NewByDB(db)
+}
+
+// NewByDB the db must be in the WAL mode and have the "store" table created by New
+func NewByDB(db *sql.DB) *SQLite {
+	return &SQLite{
+		db:           db,
+		PrefetchSize: 50,
+	}
+}
+
+// Do ...
+func (s *SQLite) Do(update bool, fn kvstore.DoTxn) error {
+	ctx := context.Background()
+
+	// the temp table and the transactions must use the same connection
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if update {
+		_, err = conn.ExecContext(ctx, `
+			CREATE TEMP TABLE IF NOT EXISTS writes (
+				key BLOB PRIMARY KEY,
+				val BLOB
+			) WITHOUT ROWID;
+			CREATE TEMP TABLE IF NOT EXISTS reads (
+				key BLOB PRIMARY KEY,
+				val BLOB
+			) WITHOUT ROWID;
+			DELETE FROM temp.writes;
+			DELETE FROM temp.reads;
+		`)
+		if err != nil {
+			return err
+		}
+	}
+
+	txn, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// the connection can't be closed before the transaction is done
+	defer func() { _ = txn.Rollback() }()
+
+	// the snapshot begins with the first read, not the BEGIN
+	_, err = txn.Exec(`SELECT 1 FROM main.store LIMIT 1`)
+	if err != nil {
+		return err
+	}
+
+	err = fn(&Txn{
+		db:     s,
+		txn:    txn,
+		update: update,
+	})
+	if err != nil {
+		return err
+	}
+
+	// end the snapshot, the temp writes are kept
+	err = txn.Commit()
+	if err != nil || !update {
+		return err
+	}
+
+	return s.write(ctx, conn)
+}
+
+// write the temp writes of the connection to the store
+func (s *SQLite) write(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`)
+	if err != nil {
+		return err
+	}
+
+	// the values read are compared only if there's anything to write, the NULL means the key didn't exist
+	var conflict bool
+	err = conn.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM temp.writes) AND EXISTS (
+			SELECT 1 FROM temp.reads r WHERE r.val IS NOT (SELECT val FROM main.store s WHERE s.key = r.key)
+		)
+	`).Scan(&conflict)
+	if err == nil && conflict {
+		err = ErrConflict
+	}
+	if err != nil {
+		_, _ = conn.ExecContext(ctx, `ROLLBACK`)
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		INSERT OR REPLACE INTO main.store (key, val) SELECT key, val FROM temp.writes WHERE val IS NOT NULL;
+		DELETE FROM main.store WHERE key IN (SELECT key FROM temp.writes WHERE val IS NULL);
+	`)
+	if err != nil {
+		_, _ = conn.ExecContext(ctx, `ROLLBACK`)
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `COMMIT`)
+	return err
+}
+
+// Close ...
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// Txn ...
+type Txn struct {
+	db     *SQLite
+	txn    *sql.Tx
+	update bool
+}
+
+var _ kvstore.Txn = &Txn{}
+
+// Get ...
+func (t *Txn) Get(key []byte) ([]byte, error) {
+	if t.update {
+		var val []byte
+		var deleted bool
+		err := t.txn.QueryRow(`SELECT val, val IS NULL FROM temp.writes WHERE key = ?`, key).Scan(&val, &deleted)
+		if err == nil {
+			if deleted {
+				return nil, kvstore.ErrKeyNotFound
+			}
+			return append([]byte{}, val...), nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		// only the first read matters
+		_, err = t.txn.Exec(
+			`INSERT OR IGNORE INTO temp.reads (key, val) VALUES (?, (SELECT val FROM main.store WHERE key = ?))`,
+			key, key,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var val []byte
+	err := t.txn.QueryRow(`SELECT val FROM main.store WHERE key = ?`, key).Scan(&val)
+	if err == sql.ErrNoRows {
+		return nil, kvstore.ErrKeyNotFound
+	}
+	// the empty blob is scanned as nil
+	return append([]byte{}, val...), err
+}
+
+// Set ...
+func (t *Txn) Set(key, value []byte) error {
+	// the nil will be treated as a deletion
+	if value == nil {
+		value = []byte{}
+	}
+	return t.set(key, value)
+}
+
+// Delete ...
+func (t *Txn) Delete(key []byte) error {
+	return t.set(key, nil)
+}
+
+func (t *Txn) set(key, value []byte) error {
+	if !t.update {
+		return ErrReadOnly
+	}
+
+	_, err := t.txn.Exec(
+		`INSERT OR REPLACE INTO temp.writes (key, val) VALUES (?, ?)`,
+		key, value,
+	)
+	return err
+}
+
+// getKeys the keys after the from in the iteration order, if the from is nil there's no limit
+func (t *Txn) getKeys(reverse bool, from []byte, inclusive bool) ([][]byte, error) {
+	table := `main.store`
+	if t.update {
+		// merge the writes of the transaction with the snapshot
+		table = `(
+			SELECT key FROM main.store WHERE key NOT IN (SELECT key FROM temp.writes)
+			UNION ALL
+			SELECT key FROM temp.writes WHERE val IS NOT NULL
+		)`
+	}
+
+	op, order := `>`, `ASC`
+	if reverse {
+		op, order = `<`, `DESC`
+	}
+	if inclusive {
+		op += `=`
+	}
+
+	where, args := `1`, []interface{}{}
+	if from != nil {
+		where, args = `key `+op+` ?`, append(args, from)
+	}
+
+	rows, err := t.txn.Query(
+		`SELECT key FROM `+table+` WHERE `+where+` ORDER BY key `+order+` LIMIT ?`,
+		append(args, t.db.PrefetchSize)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	keys := [][]byte{}
+	for rows.Next() {
+		var key []byte
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Do the reverse iteration begins with the last key less than or equal to the from,
+// if the from is nil it begins with the last key
+func (t *Txn) Do(reverse bool, from []byte, fn kvstore.Iteratee) error {
+	inclusive := true
+	for {
+		keys, err := t.getKeys(reverse, from, inclusive)
+		if err != nil {
+			return err
+		}
+
+		for _, from = range keys {
+			err = fn(from)
+			if err == kvstore.ErrStop {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < t.db.PrefetchSize {
+			return nil
+		}
+		inclusive = false
+	}
+}
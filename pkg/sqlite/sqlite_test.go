@@ -0,0 +1,115 @@
+package sqlite_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/kvstore/kvtest"
+	"github.com/ysmood/storer/pkg/sqlite"
+)
+
+// open the same database file via a pool that has only one connection, so that every transaction
+// of the returned adapter reuses the same connection
+func openSingle(path string) *sqlite.SQLite {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)")
+	kit.E(err)
+	db.SetMaxOpenConns(1)
+	return sqlite.NewByDB(db)
+}
+
+func TestReaderNotBlocked(t *testing.T) {
+	path := filepath.Join("tmp", kit.RandString(10)+".db")
+	db := sqlite.New(path)
+
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		return txn.Set([]byte("a"), []byte("1"))
+	}))
+
+	// another writer holds the write lock of the file
+	writer, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(10000)")
+	kit.E(err)
+	defer func() { _ = writer.Close() }()
+
+	var mode string
+	kit.E(writer.QueryRow(`PRAGMA journal_mode`).Scan(&mode))
+	assert.Equal(t, "wal", mode)
+
+	tx, err := writer.Begin()
+	kit.E(err)
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.Exec(`INSERT OR REPLACE INTO store (key, val) VALUES ('a', '2')`)
+	kit.E(err)
+
+	// the reader reads the last committed data without waiting for the writer
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		val, err := txn.Get([]byte("a"))
+		kit.E(err)
+		assert.Equal(t, "1", string(val))
+		return nil
+	}))
+}
+
+func TestTempTablesReused(t *testing.T) {
+	path := filepath.Join("tmp", kit.RandString(10)+".db")
+	other := sqlite.New(path)
+	db := openSingle(path)
+
+	// the temp writes of a conflicted transaction are left in the connection
+	err := db.Do(true, func(txn kvstore.Txn) error {
+		_, _ = txn.Get([]byte("k"))
+
+		kit.E(other.Do(true, func(txn kvstore.Txn) error {
+			return txn.Set([]byte("k"), []byte("1"))
+		}))
+
+		return txn.Set([]byte("a"), []byte("1"))
+	})
+	assert.Equal(t, sqlite.ErrConflict, err)
+
+	// the next transaction of the same connection only writes its own writes, and it
+	// doesn't conflict with the reads of the previous one
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		return txn.Set([]byte("b"), []byte("1"))
+	}))
+
+	kit.E(other.Do(false, func(txn kvstore.Txn) error {
+		_, err := txn.Get([]byte("a"))
+		assert.Equal(t, kvstore.ErrKeyNotFound, err)
+		_, err = txn.Get([]byte("b"))
+		return err
+	}))
+}
+
+func TestNestedUpdate(t *testing.T) {
+	db := sqlite.New("")
+
+	// the nested update writes while the outer one is open, the outer one takes the write lock after it
+	kit.E(db.Do(true, func(txn kvstore.Txn) error {
+		kit.E(txn.Set([]byte("a"), []byte("1")))
+
+		kit.E(db.Do(true, func(txn kvstore.Txn) error {
+			return txn.Set([]byte("b"), []byte("2"))
+		}))
+
+		return txn.Set([]byte("c"), []byte("3"))
+	}))
+
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		for _, k := range []string{"a", "b", "c"} {
+			_, err := txn.Get([]byte(k))
+			kit.E(err)
+		}
+		return nil
+	}))
+}
+
+func TestSuite(t *testing.T) {
+	kvtest.Suite{
+		Open:     func() kvstore.Store { return sqlite.New("") },
+		Conflict: sqlite.ErrConflict,
+	}.Run(t)
+}
@@ -2,15 +2,25 @@ package typee
 
 import (
 	"crypto/md5"
+	"encoding"
 	"fmt"
 	"reflect"
 	"sort"
 	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
 )
 
+// FingerprintScheme the version of the fingerprint scheme, it will be prepended to the fingerprints
+// before hashing, so that the hashes of different schemes will never be the same
+const FingerprintScheme = "v2"
+
 // String as long as the passed in value is the same type
 // same string will be returned.
 // The order of the struct fields doesn't matter.
+// It's the legacy fingerprint scheme, it's only used to read the data encoded by the legacy type ids,
+// use Fingerprint instead.
 func String(t reflect.Type) string {
 	return toString(t, 0)
 }
@@ -47,10 +57,39 @@ func toString(t reflect.Type, level int) string {
 	}
 }
 
-// Hash get hash value of the type
+// recursive check if the toString will never end for the type, it follows the same path as the toString
+func recursive(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	switch t.Kind() {
+	case reflect.Struct:
+		if visiting[t] {
+			return true
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			if recursive(t.Field(i).Type, visiting) {
+				return true
+			}
+		}
+		return false
+	case reflect.Slice, reflect.Array:
+		return recursive(t.Elem(), visiting)
+	case reflect.Map:
+		return recursive(t.Key(), visiting) || recursive(t.Elem(), visiting)
+	default:
+		return false
+	}
+}
+
+// Hash get hash value of the type via the legacy fingerprint scheme, use HashFingerprint instead.
+// The legacy scheme can't describe recursive types, nil will be returned for them.
 func Hash(types ...reflect.Type) []byte {
 	s := ""
 	for _, t := range types {
+		if recursive(t, map[reflect.Type]bool{}) {
+			return nil
+		}
 		s += String(t)
 	}
 
@@ -58,3 +97,154 @@ func Hash(types ...reflect.Type) []byte {
 	h := md5.Sum([]byte(s))
 	return h[:]
 }
+
+// Fingerprint is like String, but it's faithful to what the msgpack codec serializes.
+// It respects the msgpack tags, inlines embedded structs, follows pointers, keeps the difference between
+// slices and scalars, and it's safe for recursive types.
+// The order of the struct fields doesn't matter, unless the struct is encoded as an array.
+func Fingerprint(t reflect.Type) string {
+	return fingerprint(t, 0, map[reflect.Type]bool{})
+}
+
+// HashFingerprint get hash value of the type via the Fingerprint
+func HashFingerprint(types ...reflect.Type) []byte {
+	s := FingerprintScheme
+	for _, t := range types {
+		s += "\n" + Fingerprint(t)
+	}
+
+	h := md5.Sum([]byte(s))
+	return h[:]
+}
+
+var typeTime = reflect.TypeOf(time.Time{})
+var typeCustomEncoder = reflect.TypeOf((*msgpack.CustomEncoder)(nil)).Elem()
+var typeMarshaler = reflect.TypeOf((*msgpack.Marshaler)(nil)).Elem()
+var typeBinaryMarshaler = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+
+// the types that are encoded by themselves, their fields don't matter
+func isCustom(t reflect.Type) bool {
+	if t == typeTime {
+		return true
+	}
+
+	for _, i := range []reflect.Type{typeCustomEncoder, typeMarshaler, typeBinaryMarshaler} {
+		if t.Implements(i) || reflect.PtrTo(t).Implements(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// the visiting holds the struct types that are being fingerprinted, to detect cycles
+func fingerprint(t reflect.Type, level int, visiting map[reflect.Type]bool) string {
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && isCustom(t) {
+		return "custom " + t.String()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if visiting[t] {
+			return "ref " + t.String()
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		asArray, fields := structFields(t, level, visiting)
+		if !asArray {
+			sort.Strings(fields)
+		}
+
+		prefix := ""
+		if asArray {
+			prefix = "array"
+		}
+		return prefix + "{" + newline(level+1) + strings.Join(fields, newline(level+1)) + newline(level) + "}"
+	case reflect.Ptr:
+		return "*" + fingerprint(t.Elem(), level, visiting)
+	case reflect.Slice:
+		return "[]" + fingerprint(t.Elem(), level, visiting)
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), fingerprint(t.Elem(), level, visiting))
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", fingerprint(t.Key(), level, visiting), fingerprint(t.Elem(), level, visiting))
+	case reflect.Interface:
+		return t.String()
+	default:
+		return t.Kind().String()
+	}
+}
+
+// get the encoded fields of a struct like the msgpack codec, each field is like "name type"
+func structFields(t reflect.Type, level int, visiting map[reflect.Type]bool) (bool, []string) {
+	asArray := false
+	fields := []string{}
+	names := map[string]bool{}
+
+	add := func(name, str string) {
+		if names[name] {
+			return
+		}
+		names[name] = true
+		fields = append(fields, name+" "+str)
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, opts := parseTag(f.Tag.Get("msgpack"))
+		if name == "-" {
+			continue
+		}
+
+		if f.Name == "_msgpack" {
+			asArray = hasOpt(opts, "asArray")
+			continue
+		}
+
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		// embedded structs are inlined, the outer fields shadow the inner ones
+		if f.Anonymous && !hasOpt(opts, "noinline") {
+			elem := f.Type
+			for elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct && !isCustom(elem) && !visiting[elem] {
+				visiting[elem] = true
+				_, inner := structFields(elem, level, visiting)
+				delete(visiting, elem)
+
+				for _, field := range inner {
+					kv := strings.SplitN(field, " ", 2)
+					add(kv[0], kv[1])
+				}
+				continue
+			}
+		}
+
+		add(name, fingerprint(f.Type, level+1, visiting))
+	}
+
+	return asArray, fields
+}
+
+func parseTag(tag string) (string, []string) {
+	list := strings.Split(tag, ",")
+	return list[0], list[1:]
+}
+
+func hasOpt(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
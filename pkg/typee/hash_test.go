@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ysmood/storer/pkg/typee"
@@ -57,3 +58,59 @@ func TestHash(t *testing.T) {
 
 	assert.Equal(t, fixture02, fmt.Sprintf("%x", typee.Hash(p)))
 }
+
+type Node struct {
+	Name     string `msgpack:"name"`
+	Children []*Node
+	private  int
+	Ignored  int `msgpack:"-"`
+}
+
+type Base struct {
+	ID string
+}
+
+type Post struct {
+	Base
+	Title  string
+	Tags   []string
+	Meta   interface{}
+	At     time.Time
+	Author *Node
+}
+
+type Point struct {
+	_msgpack struct{} `msgpack:",asArray"`
+	Y        int
+	X        int
+}
+
+func TestFingerprint(t *testing.T) {
+	assert.Equal(t, `{
+    Children []*ref typee_test.Node
+    name string
+}`, typee.Fingerprint(reflect.TypeOf(Node{})))
+
+	assert.Equal(t, `{
+    At custom time.Time
+    Author *{
+        Children []*ref typee_test.Node
+        name string
+    }
+    ID string
+    Meta interface {}
+    Tags []string
+    Title string
+}`, typee.Fingerprint(reflect.TypeOf(Post{})))
+
+	assert.Equal(t, `array{
+    Y int
+    X int
+}`, typee.Fingerprint(reflect.TypeOf(Point{})))
+
+	// slices and scalars are different
+	assert.NotEqual(t, typee.HashFingerprint(reflect.TypeOf([]int{})), typee.HashFingerprint(reflect.TypeOf(1)))
+	assert.Equal(t, typee.Hash(reflect.TypeOf([]int{})), typee.Hash(reflect.TypeOf(1)))
+
+	assert.Equal(t, "map[string][2]uint8", typee.Fingerprint(reflect.TypeOf(map[string][2]byte{})))
+}
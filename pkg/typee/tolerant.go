@@ -0,0 +1,50 @@
+package typee
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Tolerant the optional interface to enable the tolerant mode of a type. In the tolerant mode, if the
+// data of an unknown version only has compatible changes, such as adding or removing fields, the data will
+// be decoded by field names, so a Precedent type is not required. Only the default msgpack encoding
+// supports the tolerant mode, because it encodes structs as maps.
+type Tolerant interface {
+	// Tolerant should return true to enable the tolerant mode
+	Tolerant() bool
+}
+
+// Tolerate decide whether the data of the version can be decoded into the item by field names
+type Tolerate func(version []byte, item interface{}) (bool, error)
+
+// Fields get the encoded field names of a struct type and the Fingerprint of their types,
+// nil will be returned if the type is not a struct
+func Fields(t reflect.Type) map[string]string {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	_, list := structFields(t, 0, map[reflect.Type]bool{t: true})
+
+	fields := map[string]string{}
+	for _, field := range list {
+		kv := strings.SplitN(field, " ", 2)
+		fields[kv[0]] = kv[1]
+	}
+	return fields
+}
+
+// Compatible returns true if the data encoded by the old fields can be decoded into the new fields by
+// field names, the fields that exist in both must have the same type
+func Compatible(old, new map[string]string) bool {
+	if old == nil || new == nil {
+		return false
+	}
+
+	for name, t := range old {
+		if n, has := new[name]; has && n != t {
+			return false
+		}
+	}
+	return true
+}
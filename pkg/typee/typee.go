@@ -37,6 +37,14 @@ type Migratable interface {
 	Migrate(item interface{})
 }
 
+// Downgradable the optional interface for Migratable types to convert the item back to
+// its precedent type, so that the data can be read by the old binaries after a rollback
+type Downgradable interface {
+	Migratable
+	// Downgrade method used to convert the item to the precedent item, the item is created by Precedent
+	Downgrade(item interface{})
+}
+
 // GenID generate an unique id
 func GenID(val interface{}) []byte {
 	id, ok := val.(Unique)
@@ -77,6 +85,13 @@ var ErrMigrated = errors.New("[storer.typee] migrated")
 
 // Decode when data is migrated ErrMigrated will be returned
 func Decode(versioned []byte, item interface{}, mapper Mapper) error {
+	return DecodeTolerant(versioned, item, mapper, nil)
+}
+
+// DecodeTolerant is the same as Decode, but if the version is not in the type history, the Tolerant types
+// of the history will be checked via the tolerate function, the data will be decoded by field names
+// into the first one that is tolerated. ErrMigrated will be returned if the data is tolerated.
+func DecodeTolerant(versioned []byte, item interface{}, mapper Mapper, tolerate Tolerate) error {
 	var version, data []byte
 
 	err := byframe.DecodeTuple(versioned, &version, &data)
@@ -84,7 +99,7 @@ func Decode(versioned []byte, item interface{}, mapper Mapper) error {
 		return err
 	}
 
-	tasks, item, err := migrateTasks(item, version, mapper)
+	tasks, item, migrated, err := migrateTasks(item, version, mapper, tolerate)
 	if err != nil {
 		return err
 	}
@@ -107,41 +122,146 @@ func Decode(versioned []byte, item interface{}, mapper Mapper) error {
 		item = elem
 	}
 
-	if len(tasks) > 0 {
+	if migrated {
 		return ErrMigrated
 	}
 
 	return nil
 }
 
+// Version get the version of the encoded data without decoding the data
+func Version(versioned []byte) ([]byte, error) {
+	var version, data []byte
+	err := byframe.DecodeTuple(versioned, &version, &data)
+	return version, err
+}
+
 // ErrNotMigratable ...
 var ErrNotMigratable = errors.New("[storer.typee] item must implement Migratable interface")
 
-func migrateTasks(item interface{}, version []byte, mapper Mapper) ([]Migratable, interface{}, error) {
+func migrateTasks(item interface{}, version []byte, mapper Mapper, tolerate Tolerate) (
+	[]Migratable, interface{}, bool, error,
+) {
 	if mapper == nil {
 		mapper = defaultMapper
 	}
 
 	list := []Migratable{}
+	latest := item
 
 	for {
-		itemVersion, err := mapper(GenTypeID(item).ID)
+		typeID := GenTypeID(item)
+
+		itemVersion, err := mapper(typeID.ID)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, false, err
 		}
 
 		if bytes.Equal(version, itemVersion) {
-			return list, item, nil
+			return list, item, len(list) > 0, nil
+		}
+
+		// the data encoded with the legacy type id is the same type, it's not migrated,
+		// it will be written with the new id by the next write. The recursive types have no legacy type id
+		if typeID.Legacy != nil {
+			legacyVersion, err := mapper(typeID.Legacy)
+			if err != nil {
+				return nil, nil, false, err
+			}
+
+			if bytes.Equal(version, legacyVersion) {
+				return list, item, len(list) > 0, nil
+			}
 		}
 
 		m, ok := item.(Migratable)
 		if !ok {
-			return nil, nil, ErrNotMigratable
+			break
 		}
 		list = append(list, m)
 
 		item = m.Precedent()
 	}
+
+	// the explicit migrations take precedence over the tolerant mode
+	if tolerate != nil {
+		list = []Migratable{}
+		item = latest
+
+		for {
+			if t, ok := item.(Tolerant); ok && t.Tolerant() {
+				ok, err := tolerate(version, item)
+				if err != nil {
+					return nil, nil, false, err
+				}
+				if ok {
+					return list, item, true, nil
+				}
+			}
+
+			m, ok := item.(Migratable)
+			if !ok {
+				break
+			}
+			list = append(list, m)
+
+			item = m.Precedent()
+		}
+	}
+
+	return nil, nil, false, ErrNotMigratable
+}
+
+// ErrNotDowngradable ...
+var ErrNotDowngradable = errors.New("[storer.typee] item must implement Downgradable interface")
+
+// ErrUnknownVersion ...
+var ErrUnknownVersion = errors.New("[storer.typee] version is not in the type history")
+
+// Downgrade convert the item to the precedent type of the version, each type between them
+// must implement Downgradable. The item itself will be returned if the version is its own version.
+func Downgrade(item interface{}, version []byte, mapper Mapper) (interface{}, error) {
+	if mapper == nil {
+		mapper = defaultMapper
+	}
+
+	// make sure the version is in the history before any conversion
+	for pre := item; ; {
+		preVersion, err := mapper(GenTypeID(pre).ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(version, preVersion) {
+			break
+		}
+
+		m, ok := pre.(Migratable)
+		if !ok {
+			return nil, ErrUnknownVersion
+		}
+		pre = m.Precedent()
+	}
+
+	for {
+		itemVersion, err := mapper(GenTypeID(item).ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(version, itemVersion) {
+			return item, nil
+		}
+
+		d, ok := item.(Downgradable)
+		if !ok {
+			return nil, ErrNotDowngradable
+		}
+
+		pre := d.Precedent()
+		d.Downgrade(pre)
+		item = pre
+	}
 }
 
 // Mapper persistently map long bytes to short bytes.
@@ -160,6 +280,9 @@ var typeIDCache = &sync.Map{}
 type TypeID struct {
 	// ID ...
 	ID []byte
+	// Legacy the id generated by the legacy fingerprint scheme, the data encoded with it can still be decoded.
+	// It's nil for the recursive types.
+	Legacy []byte
 	// Anchor ...
 	Anchor string
 	// Type ...
@@ -182,17 +305,11 @@ func GenTypeID(item interface{}) *TypeID {
 		return typeID.(*TypeID)
 	}
 
-	history := []reflect.Type{t}
-
-	m, ok := item.(Migratable)
-	for ok {
-		pre := m.Precedent()
-		history = append(history, getElemType(pre))
-		m, ok = pre.(Migratable)
-	}
+	history := historyTypes(item)
 
 	typeID := &TypeID{
-		ID:     Hash(history...),
+		ID:     HashFingerprint(history...),
+		Legacy: Hash(history...),
 		Anchor: anchor,
 		Type:   t,
 	}
@@ -200,6 +317,39 @@ func GenTypeID(item interface{}) *TypeID {
 	return typeID
 }
 
+// VersionInfo a version of the type history
+type VersionInfo struct {
+	// ID the type id of the version, the same as the GenTypeID when the type was the latest one
+	ID []byte
+	// Legacy the id generated by the legacy fingerprint scheme
+	Legacy []byte
+	// Type ...
+	Type reflect.Type
+}
+
+// History get all the versions of the item type via Precedent, the latest version first
+func History(item interface{}) []*VersionInfo {
+	types := historyTypes(item)
+
+	list := make([]*VersionInfo, len(types))
+	for i, t := range types {
+		list[i] = &VersionInfo{ID: HashFingerprint(types[i:]...), Legacy: Hash(types[i:]...), Type: t}
+	}
+	return list
+}
+
+func historyTypes(item interface{}) []reflect.Type {
+	history := []reflect.Type{getElemType(item)}
+
+	m, ok := item.(Migratable)
+	for ok {
+		pre := m.Precedent()
+		history = append(history, getElemType(pre))
+		m, ok = pre.(Migratable)
+	}
+	return history
+}
+
 // ErrNotPtr ...
 var ErrNotPtr = errors.New("[storer.typee] must be a pointer to the item")
 
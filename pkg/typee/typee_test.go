@@ -2,9 +2,13 @@ package typee_test
 
 import (
 	"fmt"
+	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack"
+	"github.com/ysmood/byframe"
 	"github.com/ysmood/storer/pkg/typee"
 )
 
@@ -14,8 +18,26 @@ type TestType struct {
 }
 
 func TestGenTypeID(t *testing.T) {
-	hash := typee.GenTypeID(&TestType{}).ID
-	assert.Equal(t, "04182418b3f271d3b24b75da9902a174", fmt.Sprintf("%x", hash))
+	typeID := typee.GenTypeID(&TestType{})
+	assert.Equal(t, "2698cf15bc8244cd8509e7ef8e76a39d", fmt.Sprintf("%x", typeID.ID))
+	assert.Equal(t, "04182418b3f271d3b24b75da9902a174", fmt.Sprintf("%x", typeID.Legacy))
+}
+
+type Tree struct {
+	Kids []Tree
+}
+
+func TestGenTypeIDRecursive(t *testing.T) {
+	typeID := typee.GenTypeID(&Tree{})
+	assert.Len(t, typeID.ID, 16)
+	assert.Nil(t, typeID.Legacy)
+	assert.Nil(t, typee.History(&Tree{})[0].Legacy)
+
+	data, err := typee.Encode(&Tree{Kids: []Tree{{}}}, nil)
+	assert.Nil(t, err)
+	var tree Tree
+	assert.Nil(t, typee.Decode(data, &tree, nil))
+	assert.Len(t, tree.Kids, 1)
 }
 
 type UserV0 struct {
@@ -35,6 +57,12 @@ func (u *UserV1) Migrate(item interface{}) {
 	u.Str = fmt.Sprint(old.Int)
 }
 
+var _ typee.Downgradable = &UserV1{}
+
+func (u *UserV1) Downgrade(item interface{}) {
+	item.(*UserV0).Int, _ = strconv.Atoi(u.Str)
+}
+
 type User struct {
 	Name string
 }
@@ -65,3 +93,96 @@ func TestMigration(t *testing.T) {
 	_ = typee.Decode(data1, &vFrom1, nil)
 	assert.Equal(t, "1", vFrom1.Name)
 }
+
+func TestVersion(t *testing.T) {
+	data, _ := typee.Encode(&UserV0{0}, nil)
+	v, err := typee.Version(data)
+	assert.Nil(t, err)
+	assert.Equal(t, typee.GenTypeID(&UserV0{}).ID, v)
+
+	_, err = typee.Version([]byte{10})
+	assert.Error(t, err)
+}
+
+func TestDowngrade(t *testing.T) {
+	v0 := typee.GenTypeID(&UserV0{}).ID
+	v1 := typee.GenTypeID(&UserV1{}).ID
+
+	item, err := typee.Downgrade(&UserV1{"10"}, v0, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &UserV0{10}, item)
+
+	item, err = typee.Downgrade(&UserV1{"10"}, v1, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &UserV1{"10"}, item)
+
+	// User doesn't implement Downgradable
+	_, err = typee.Downgrade(&User{"10"}, v0, nil)
+	assert.Equal(t, typee.ErrNotDowngradable, err)
+
+	_, err = typee.Downgrade(&UserV1{"10"}, []byte("unknown"), nil)
+	assert.Equal(t, typee.ErrUnknownVersion, err)
+}
+
+func TestHistory(t *testing.T) {
+	list := typee.History(&User{})
+
+	assert.Len(t, list, 3)
+	assert.Equal(t, typee.GenTypeID(&User{}).ID, list[0].ID)
+	assert.Equal(t, typee.GenTypeID(&UserV1{}).ID, list[1].ID)
+	assert.Equal(t, typee.GenTypeID(&UserV0{}).ID, list[2].ID)
+	assert.Equal(t, "UserV0", list[2].Type.Name())
+}
+
+type Member struct {
+	Name string `msgpack:"name"`
+	Age  int
+}
+
+var _ typee.Tolerant = &Member{}
+
+func (m *Member) Tolerant() bool { return true }
+
+func TestFields(t *testing.T) {
+	assert.Equal(t, map[string]string{"name": "string", "Age": "int"}, typee.Fields(reflect.TypeOf(Member{})))
+	assert.Nil(t, typee.Fields(reflect.TypeOf(1)))
+
+	assert.True(t, typee.Compatible(map[string]string{"a": "int"}, map[string]string{"a": "int", "b": "string"}))
+	assert.True(t, typee.Compatible(map[string]string{"a": "int", "b": "string"}, map[string]string{"a": "int"}))
+	assert.False(t, typee.Compatible(map[string]string{"a": "int"}, map[string]string{"a": "string"}))
+}
+
+func TestDecodeTolerant(t *testing.T) {
+	type memberV1 struct {
+		Name  string `msgpack:"name"`
+		Email string
+	}
+
+	data, _ := typee.Encode(&memberV1{"jack", "a@b.c"}, nil)
+
+	tolerate := func(version []byte, item interface{}) (bool, error) {
+		old := typee.Fields(reflect.TypeOf(memberV1{}))
+		return typee.Compatible(old, typee.Fields(reflect.TypeOf(item).Elem())), nil
+	}
+
+	var m Member
+	err := typee.DecodeTolerant(data, &m, nil, tolerate)
+	assert.Equal(t, typee.ErrMigrated, err)
+	assert.Equal(t, Member{Name: "jack"}, m)
+
+	assert.Equal(t, typee.ErrNotMigratable, typee.Decode(data, &m, nil))
+
+	// the item is not tolerant
+	var u UserV0
+	assert.Equal(t, typee.ErrNotMigratable, typee.DecodeTolerant(data, &u, nil, tolerate))
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	legacy := typee.GenTypeID(&TestType{}).Legacy
+	data, _ := msgpack.Marshal(&TestType{"a", 1})
+
+	var item TestType
+	err := typee.Decode(byframe.EncodeTuple(&legacy, &data), &item, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, TestType{"a", 1}, item)
+}
@@ -0,0 +1,80 @@
+package storer
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/ysmood/byframe"
+)
+
+// The format of a record in the database:
+//
+//	| 0 | meta frame | typee data |
+//
+// The meta is a list of uvarints, new fields can only be appended.
+// Records written before the meta existed begin with the header of the typee version
+// frame which can't be 0, so they can still be decoded.
+type record struct {
+	// expireAt unix nano time, 0 means never expire
+	expireAt int64
+
+	// revision increases each time the record is written, it starts from 1
+	revision uint64
+
+	// data the typee encoded item
+	data []byte
+}
+
+func (r *record) encode() []byte {
+	meta := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutUvarint(meta, uint64(r.expireAt))
+	n += binary.PutUvarint(meta[n:], r.revision)
+	meta = meta[:n]
+
+	return append([]byte{0}, byframe.EncodeTuple(&meta, &r.data)...)
+}
+
+func decodeRecord(raw []byte) (*record, error) {
+	if len(raw) == 0 || raw[0] != 0 {
+		return &record{revision: 1, data: raw}, nil
+	}
+
+	var meta, data []byte
+	err := byframe.DecodeTuple(raw[1:], &meta, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &record{data: data}
+
+	var expireAt uint64
+	fields := []*uint64{&expireAt, &r.revision}
+	for _, f := range fields {
+		v, n := binary.Uvarint(meta)
+		if n <= 0 {
+			break
+		}
+		*f = v
+		meta = meta[n:]
+	}
+	r.expireAt = int64(expireAt)
+
+	// the record is written before the revision existed
+	if r.revision == 0 {
+		r.revision = 1
+	}
+
+	return r, nil
+}
+
+func (r *record) expired() bool {
+	return r.expireAt != 0 && time.Now().UnixNano() >= r.expireAt
+}
+
+// the revision for the next write of the record
+func nextRevision(prev *record) uint64 {
+	if prev == nil {
+		return 1
+	}
+	return prev.revision + 1
+}
@@ -0,0 +1,153 @@
+package storer
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// rename all the buckets whose names begin with the prefix, the rest part of the names won't change
+func (store *Store) renameBuckets(txn kvstore.Txn, from, to string) error {
+	names, err := bucket.Names(txn)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if !bytes.HasPrefix(name, []byte(from)) {
+			continue
+		}
+		err = bucket.Rename(txn, name, []byte(to+strings.TrimPrefix(string(name), from)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rename the expiry index of the collection if it exists
+func renameExpiry(txn kvstore.Txn, from, to string) error {
+	err := bucket.Rename(txn, []byte(from+":expiry"), []byte(to+":expiry"))
+	if err == ErrKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+// Rename the map, only the name mapping will be changed, the data won't be rewritten
+func (m *Map) Rename(name string) error {
+	from := m.store.bucketName(m.typeID.Anchor, m.name)
+	to := m.store.bucketName(m.typeID.Anchor, name)
+
+	err := m.store.Update(func(txn Txn) error {
+		err := bucket.Rename(txn, []byte(from), []byte(to))
+		if err != nil {
+			return err
+		}
+		err = m.store.renameSchema(txn, from, to)
+		if err != nil {
+			return err
+		}
+		return renameExpiry(txn, from, to)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.name = name
+	return nil
+}
+
+// Rename the list with all its indexes and id sequence in a single transaction, only the
+// name mapping will be changed, the data won't be rewritten.
+func (list *List) Rename(name string) error {
+	dict := list.dict
+	from := dict.store.bucketName(dict.typeID.Anchor, dict.name)
+	to := dict.store.bucketName(dict.typeID.Anchor, name)
+
+	err := dict.store.Update(func(txn Txn) error {
+		err := bucket.Rename(txn, []byte(from), []byte(to))
+		if err != nil {
+			return err
+		}
+
+		err = dict.store.renameSchema(txn, from, to)
+		if err != nil {
+			return err
+		}
+
+		for _, kind := range []string{"index", "rindex"} {
+			err = dict.store.renameBuckets(txn, from+":"+kind+":", to+":"+kind+":")
+			if err != nil {
+				return err
+			}
+		}
+
+		err = renameExpiry(txn, from, to)
+		if err != nil {
+			return err
+		}
+
+		err = bucket.Rename(txn, []byte(from+":sequence"), []byte(to+":sequence"))
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	dict.name = name
+	return nil
+}
+
+// Rename the index, the index function won't change
+func (index *Index) Rename(name string) error {
+	if _, has := index.list.indexes[name]; has {
+		return ErrIndexExists
+	}
+
+	dict := index.list.dict
+
+	err := dict.store.Update(func(txn Txn) error {
+		for _, kind := range []string{"index", "rindex"} {
+			err := bucket.Rename(
+				txn,
+				[]byte(dict.store.bucketName(dict.typeID.Anchor, dict.name, kind, index.name)),
+				[]byte(dict.store.bucketName(dict.typeID.Anchor, dict.name, kind, name)),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	delete(index.list.indexes, index.name)
+	index.name = name
+	index.list.indexes[name] = index
+	return nil
+}
+
+// Drop remove the index and all its data, the index will be removed from the list,
+// it shouldn't be used after the drop.
+func (index *Index) Drop() error {
+	dict := index.list.dict
+
+	for _, kind := range []string{"index", "rindex"} {
+		err := dict.store.DropBucket(dict.store.bucketName(dict.typeID.Anchor, dict.name, kind, index.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	// keep maintaining the index until its data is gone
+	delete(index.list.indexes, index.name)
+	return nil
+}
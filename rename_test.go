@@ -0,0 +1,94 @@
+package storer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/bucket"
+)
+
+func TestListRename(t *testing.T) {
+	store := storer.New("")
+	users := store.ListWithName("users", &Event{})
+	users.SetIDGen(users.IDGenSequence())
+	_ = users.Index("seq", func(e *Event) interface{} {
+		return e.Seq
+	})
+	_, _ = users.Add(&Event{1})
+
+	kit.E(users.Rename("members"))
+
+	counts := bucketCounts(store)
+	assert.Equal(t, 1, counts[":storer_test.Event:members"])
+	assert.Equal(t, 1, counts[":storer_test.Event:members:index:seq"])
+	assert.Equal(t, 1, counts[":storer_test.Event:members:rindex:seq"])
+	assert.Equal(t, 1, counts[":storer_test.Event:members:sequence"])
+	_, has := counts[":storer_test.Event:users"]
+	assert.False(t, has)
+
+	// reopen the list with the new name
+	members := store.ListWithName("members", &Event{})
+	members.SetIDGen(members.IDGenSequence())
+	index := members.Index("seq", func(e *Event) interface{} {
+		return e.Seq
+	})
+
+	var e Event
+	kit.E(index.From(1).Find(&e))
+	id, _ := members.Add(&Event{2})
+	assert.Equal(t, "0000000000000002", id)
+
+	assert.Equal(t, bucket.ErrBucketExists, users.Rename("members"))
+}
+
+func TestMapRename(t *testing.T) {
+	store := storer.New("")
+	dict := store.MapWithName("a", &Event{})
+	kit.E(dict.Set("k", &Event{1}))
+
+	kit.E(dict.Rename("b"))
+
+	var e Event
+	kit.E(dict.Get("k", &e))
+	kit.E(store.MapWithName("b", &Event{}).Get("k", &e))
+	assert.Equal(t, storer.ErrKeyNotFound, store.MapWithName("a", &Event{}).Get("k", &e))
+
+	assert.Equal(t, bucket.ErrBucketExists, store.MapWithName("c", &Event{}).Rename("a"))
+}
+
+func TestIndexRenameAndDrop(t *testing.T) {
+	store := storer.New("")
+	users := store.ListWithName("users", &Event{})
+	index := users.Index("seq", func(e *Event) interface{} {
+		return e.Seq
+	})
+	_ = users.Index("other", func(e *Event) interface{} {
+		return e.Seq
+	})
+	_, _ = users.Add(&Event{1})
+
+	assert.Equal(t, storer.ErrIndexExists, index.Rename("other"))
+
+	kit.E(index.Rename("level"))
+	var e Event
+	kit.E(index.From(1).Find(&e))
+
+	counts := bucketCounts(store)
+	assert.Equal(t, 1, counts[":storer_test.Event:users:index:level"])
+	_, has := counts[":storer_test.Event:users:index:seq"]
+	assert.False(t, has)
+
+	kit.E(index.Drop())
+
+	counts = bucketCounts(store)
+	_, has = counts[":storer_test.Event:users:index:level"]
+	assert.False(t, has)
+	_, has = counts[":storer_test.Event:users:rindex:level"]
+	assert.False(t, has)
+
+	// the dropped index won't be updated anymore
+	_, err := users.Add(&Event{2})
+	kit.E(err)
+}
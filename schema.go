@@ -0,0 +1,333 @@
+package storer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack"
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/typee"
+)
+
+// Schema a type version registered in the database
+type Schema struct {
+	// ID the type id generated by typee
+	ID []byte
+	// Type the string representation of the type generated by typee.Fingerprint
+	Type string
+}
+
+// Collection a map or list registered in the database
+type Collection struct {
+	// Name the full name of the collection, such as "storeName:typeAnchor:collectionName"
+	Name string
+	// History the type versions of the collection, the latest version first
+	History []*Schema
+}
+
+// ErrIncompatibleSchema ...
+var ErrIncompatibleSchema = errors.New("[storer] incompatible schema")
+
+// IncompatibleSchemaError the type of a non-empty collection is changed without Migratable
+type IncompatibleSchemaError struct {
+	Collection string
+	// Stored the latest version in the database
+	Stored *Schema
+	// Current the latest version of the running program
+	Current *Schema
+}
+
+// Error ...
+func (e *IncompatibleSchemaError) Error() string {
+	return fmt.Sprintf(
+		"%s: the type of %s changed from %s to %s, the precedent types should be defined via typee.Migratable",
+		ErrIncompatibleSchema.Error(), e.Collection, e.Stored.Type, e.Current.Type,
+	)
+}
+
+// Is ...
+func (e *IncompatibleSchemaError) Is(target error) bool {
+	return target == ErrIncompatibleSchema
+}
+
+// Collections list all the registered collections of the store and their type histories
+func (store *Store) Collections() (list []*Collection, err error) {
+	list = []*Collection{}
+
+	err = store.View(func(txn Txn) error {
+		schemas, err := bucket.Lookup(txn, []byte(store.name+":schema"))
+		if err == ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		collections, err := bucket.Lookup(txn, []byte(store.name+":collections"))
+		if err != nil {
+			return err
+		}
+
+		return txn.Do(false, collections.Prefix(nil), func(key []byte) error {
+			if !collections.Valid(key) {
+				return ErrStop
+			}
+
+			name := key[collections.Len():]
+			ids, err := loadHistory(txn, collections, name)
+			if err != nil {
+				return err
+			}
+
+			col := &Collection{Name: string(name)}
+			for _, id := range ids {
+				t, err := schemas.Get(txn, id)
+				if err != nil {
+					return err
+				}
+				col.History = append(col.History, &Schema{ID: id, Type: string(t)})
+			}
+			list = append(list, col)
+			return nil
+		})
+	})
+	return
+}
+
+// register the type history of the map, returns IncompatibleSchemaError if the stored latest version
+// can't be reached by the current type history
+func (store *Store) register(m *Map) error {
+	history := typee.History(reflect.New(m.typeID.Type).Interface())
+	name := []byte(store.bucketName(m.typeID.Anchor, m.name))
+
+	return store.Update(func(txn Txn) error {
+		schemas, err := bucket.New(txn, []byte(store.name+":schema"))
+		if err != nil {
+			return err
+		}
+
+		collections, err := bucket.New(txn, []byte(store.name+":collections"))
+		if err != nil {
+			return err
+		}
+
+		fields, err := bucket.New(txn, []byte(store.name+":fields"))
+		if err != nil {
+			return err
+		}
+
+		ids := [][]byte{}
+		for _, v := range history {
+			ids = append(ids, v.ID)
+
+			_, err := schemas.Get(txn, v.ID)
+			if err == ErrKeyNotFound {
+				err = schemas.Set(txn, v.ID, []byte(typee.Fingerprint(v.Type)))
+			}
+			if err != nil {
+				return err
+			}
+
+			err = saveFields(txn, fields, v)
+			if err != nil {
+				return err
+			}
+		}
+
+		stored, err := loadHistory(txn, collections, name)
+		if err == ErrKeyNotFound {
+			return saveHistory(txn, collections, name, ids)
+		} else if err != nil {
+			return err
+		}
+
+		if bytes.Equal(stored[0], ids[0]) {
+			return nil
+		}
+
+		// an upgrade or a rollback
+		if inHistory(ids, stored[0]) || inHistory(stored, ids[0]) {
+			return saveHistory(txn, collections, name, ids)
+		}
+
+		// the history registered with the legacy type ids
+		for _, v := range history {
+			if bytes.Equal(v.Legacy, stored[0]) {
+				return saveHistory(txn, collections, name, ids)
+			}
+		}
+
+		empty, err := m.empty(txn)
+		if err != nil {
+			return err
+		}
+		if empty {
+			return saveHistory(txn, collections, name, ids)
+		}
+
+		compatible, err := m.compatible(txn, fields, stored[0])
+		if err != nil {
+			return err
+		}
+		if compatible {
+			return saveHistory(txn, collections, name, append(ids, stored...))
+		}
+
+		t, err := schemas.Get(txn, stored[0])
+		if err != nil {
+			return err
+		}
+
+		return &IncompatibleSchemaError{
+			Collection: string(name),
+			Stored:     &Schema{ID: stored[0], Type: string(t)},
+			Current:    &Schema{ID: ids[0], Type: typee.Fingerprint(history[0].Type)},
+		}
+	})
+}
+
+// move the registered history of the collection to the new name
+func (store *Store) renameSchema(txn kvstore.Txn, from, to string) error {
+	collections, err := bucket.New(txn, []byte(store.name+":collections"))
+	if err != nil {
+		return err
+	}
+
+	ids, err := loadHistory(txn, collections, []byte(from))
+	if err == ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = collections.Delete(txn, []byte(from))
+	if err != nil {
+		return err
+	}
+	return saveHistory(txn, collections, []byte(to), ids)
+}
+
+func (m *Map) empty(txn kvstore.Txn) (bool, error) {
+	empty := true
+	err := txn.Do(false, m.bucket.Prefix(nil), func(key []byte) error {
+		empty = !m.bucket.Valid(key)
+		return ErrStop
+	})
+	return empty, err
+}
+
+// compatible returns true if the map is in the tolerant mode and the records of the version
+// can be decoded by field names
+func (m *Map) compatible(txn kvstore.Txn, fields *bucket.Bucket, id []byte) (bool, error) {
+	item := reflect.New(m.typeID.Type).Interface()
+	if t, ok := item.(typee.Tolerant); !ok || !t.Tolerant() {
+		return false, nil
+	}
+
+	b, err := bucket.Lookup(txn, id)
+	if err == ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return tolerate(txn, fields, b.Prefix(nil), item)
+}
+
+// tolerate the records of the version if the item is not encoded by custom encoding
+// and the fields of the version are compatible with the item
+func tolerate(txn kvstore.Txn, fields *bucket.Bucket, version []byte, item interface{}) (bool, error) {
+	if _, ok := item.(typee.Encoding); ok {
+		return false, nil
+	}
+
+	data, err := fields.Get(txn, version)
+	if err == ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var old map[string]string
+	err = msgpack.Unmarshal(data, &old)
+	if err != nil {
+		return false, err
+	}
+
+	return typee.Compatible(old, typee.Fields(reflect.TypeOf(item).Elem())), nil
+}
+
+// tolerate is used by typee.DecodeTolerant, the result will be cached because the
+// registered fields of a version never change
+func (dictTxn *MapTxn) tolerate(version []byte, item interface{}) (bool, error) {
+	key := string(typee.GenTypeID(item).ID) + string(version)
+	if ok, has := dictTxn.dict.store.tolerated.Load(key); has {
+		return ok.(bool), nil
+	}
+
+	fields, err := bucket.Lookup(dictTxn.txn, []byte(dictTxn.dict.store.name+":fields"))
+	if err == ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	ok, err := tolerate(dictTxn.txn, fields, version, item)
+	if err != nil {
+		return false, err
+	}
+
+	dictTxn.dict.store.tolerated.Store(key, ok)
+	return ok, nil
+}
+
+// save the fields of the version via its short id, so that the records of the version
+// can be checked by the tolerant mode without the type
+func saveFields(txn kvstore.Txn, fields *bucket.Bucket, v *typee.VersionInfo) error {
+	b, err := bucket.New(txn, v.ID)
+	if err != nil {
+		return err
+	}
+	version := b.Prefix(nil)
+
+	_, err = fields.Get(txn, version)
+	if err != ErrKeyNotFound {
+		return err
+	}
+
+	data, err := msgpack.Marshal(typee.Fields(v.Type))
+	if err != nil {
+		return err
+	}
+	return fields.Set(txn, version, data)
+}
+
+func loadHistory(txn kvstore.Txn, collections *bucket.Bucket, name []byte) ([][]byte, error) {
+	data, err := collections.Get(txn, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids [][]byte
+	err = msgpack.Unmarshal(data, &ids)
+	return ids, err
+}
+
+func saveHistory(txn kvstore.Txn, collections *bucket.Bucket, name []byte, ids [][]byte) error {
+	data, err := msgpack.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return collections.Set(txn, name, data)
+}
+
+func inHistory(ids [][]byte, id []byte) bool {
+	for _, item := range ids {
+		if bytes.Equal(item, id) {
+			return true
+		}
+	}
+	return false
+}
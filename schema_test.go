@@ -0,0 +1,154 @@
+package storer_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+	"github.com/ysmood/storer/pkg/typee"
+)
+
+// change the type of the collection just like the type is renamed in the source code
+func changeType(store *storer.Store, from, to string) {
+	kit.E(store.Update(func(txn kvstore.Txn) error {
+		err := bucket.Rename(txn, []byte(from), []byte(to))
+		if err != nil {
+			return err
+		}
+
+		collections, err := bucket.Lookup(txn, []byte(":collections"))
+		if err != nil {
+			return err
+		}
+		history, err := collections.Get(txn, []byte(from))
+		if err != nil {
+			return err
+		}
+		err = collections.Delete(txn, []byte(from))
+		if err != nil {
+			return err
+		}
+		return collections.Set(txn, []byte(to), history)
+	}))
+}
+
+func collections(store *storer.Store) map[string][]*storer.Schema {
+	list, err := store.Collections()
+	kit.E(err)
+
+	dict := map[string][]*storer.Schema{}
+	for _, col := range list {
+		dict[col.Name] = col.History
+	}
+	return dict
+}
+
+func TestCollections(t *testing.T) {
+	store := storer.New("")
+	_ = store.MapWithName("profiles", &Profile{})
+	users := store.ListWithName("users", &Event{})
+	kit.E(users.Rename("members"))
+
+	dict := collections(store)
+
+	history := dict[":storer_test.Profile:profiles"]
+	assert.Len(t, history, 2)
+	assert.Equal(t, typee.GenTypeID(&Profile{}).ID, history[0].ID)
+	assert.Equal(t, "{\n    Age string\n}", history[0].Type)
+	assert.Equal(t, "{\n    Age int\n}", history[1].Type)
+
+	assert.Len(t, dict[":storer_test.Event:members"], 1)
+	_, has := dict[":storer_test.Event:users"]
+	assert.False(t, has)
+}
+
+func TestSchemaUpgrade(t *testing.T) {
+	store := storer.New("")
+	kit.E(store.MapWithName("profiles", &ProfileV0{}).Set("a", &ProfileV0{1}))
+
+	changeType(store, ":storer_test.ProfileV0:profiles", ":storer_test.Profile:profiles")
+
+	var p Profile
+	_ = store.MapWithName("profiles", &Profile{}).Get("a", &p)
+	assert.Equal(t, "1", p.Age)
+	assert.Len(t, collections(store)[":storer_test.Profile:profiles"], 2)
+}
+
+func TestIncompatibleSchema(t *testing.T) {
+	store := storer.New("")
+	kit.E(store.MapWithName("events", &ProfileV0{}).Set("a", &ProfileV0{1}))
+
+	changeType(store, ":storer_test.ProfileV0:events", ":storer_test.Event:events")
+
+	err, _ := kit.Try(func() {
+		store.MapWithName("events", &Event{})
+	}).(error)
+	assert.True(t, errors.Is(err, storer.ErrIncompatibleSchema))
+
+	var e *storer.IncompatibleSchemaError
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, ":storer_test.Event:events", e.Collection)
+	assert.Equal(t, "{\n    Age int\n}", e.Stored.Type)
+	assert.Equal(t, "{\n    Seq int\n}", e.Current.Type)
+
+	// the type of an empty collection can be changed freely
+	changeType(store, ":storer_test.Event:events", ":storer_test.User:events")
+	kit.E(store.Update(func(txn kvstore.Txn) error {
+		b, err := bucket.Lookup(txn, []byte(":storer_test.User:events"))
+		if err != nil {
+			return err
+		}
+		return b.Empty(txn)
+	}))
+	_ = store.MapWithName("events", &User{})
+}
+
+type ContactV0 struct {
+	Name  string
+	Email string
+}
+
+type Contact struct {
+	Name  string
+	Phone string
+}
+
+var _ typee.Tolerant = &Contact{}
+
+func (c *Contact) Tolerant() bool { return true }
+
+type BadContact struct {
+	Name int
+}
+
+func (c *BadContact) Tolerant() bool { return true }
+
+func TestTolerantSchema(t *testing.T) {
+	store := storer.New("")
+	kit.E(store.MapWithName("contacts", &ContactV0{}).Set("a", &ContactV0{"jack", "a@b.c"}))
+
+	changeType(store, ":storer_test.ContactV0:contacts", ":storer_test.Contact:contacts")
+
+	contacts := store.MapWithName("contacts", &Contact{})
+	assert.Len(t, collections(store)[":storer_test.Contact:contacts"], 2)
+
+	var c Contact
+	assert.Equal(t, typee.ErrMigrated, contacts.Get("a", &c))
+	assert.Equal(t, Contact{Name: "jack"}, c)
+	kit.E(contacts.Get("a", &c))
+
+	n, err := contacts.Outdated()
+	kit.E(err)
+	assert.Equal(t, 0, n)
+
+	// the type of the field changed
+	changeType(store, ":storer_test.Contact:contacts", ":storer_test.BadContact:contacts")
+	err, _ = kit.Try(func() {
+		store.MapWithName("contacts", &BadContact{})
+	}).(error)
+	assert.True(t, errors.Is(err, storer.ErrIncompatibleSchema))
+}
@@ -0,0 +1,140 @@
+package storer
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/idgen"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// Sequence hands out monotonically increasing integers, the first one is 1.
+// To reduce the write contention, it leases a range of numbers from the database at a time.
+// The numbers of a lease that are not handed out will be skipped after restart, so there may be gaps
+// between the numbers, but a number will never be reused. Call Sequence.Release before exit to reduce gaps.
+type Sequence struct {
+	lock      sync.Mutex
+	store     *Store
+	bucket    *bucket.Bucket
+	next      uint64
+	leased    uint64
+	bandwidth uint64
+}
+
+// Sequence create a sequence that leases 100 numbers at a time
+func (store *Store) Sequence(name string) *Sequence {
+	return store.SequenceWithBandwidth(name, 100)
+}
+
+// SequenceWithBandwidth create a sequence, the bandwidth is the count of numbers to lease at a time.
+// Sequences with the same name share the same counter, even they are in different processes.
+func (store *Store) SequenceWithBandwidth(name string, bandwidth uint64) *Sequence {
+	if bandwidth == 0 {
+		bandwidth = 1
+	}
+
+	return &Sequence{
+		store:     store,
+		bucket:    store.bucket("sequence", name),
+		bandwidth: bandwidth,
+	}
+}
+
+// Next get the next number
+func (seq *Sequence) Next() (uint64, error) {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+
+	if seq.next >= seq.leased {
+		err := seq.lease()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := seq.next
+	seq.next++
+	return n, nil
+}
+
+// the counter stores the first number that hasn't been leased
+// The lease only takes effect after it's committed, or the numbers may be handed out twice.
+func (seq *Sequence) lease() error {
+	var next, leased uint64
+	err := seq.store.Update(func(txn Txn) error {
+		var err error
+		next, err = seq.counter(txn)
+		if err != nil {
+			return err
+		}
+
+		leased = next + seq.bandwidth
+		return seq.setCounter(txn, leased)
+	})
+	if err != nil {
+		return err
+	}
+
+	seq.next = next
+	seq.leased = leased
+	return nil
+}
+
+// Release give back the numbers that are leased but not handed out, it only works when
+// no other sequence with the same name has leased numbers after this one.
+// The sequence can still be used after the release.
+func (seq *Sequence) Release() error {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+
+	released := false
+	err := seq.store.Update(func(txn Txn) error {
+		n, err := seq.counter(txn)
+		if err != nil {
+			return err
+		}
+
+		released = n == seq.leased
+		if !released {
+			return nil
+		}
+
+		return seq.setCounter(txn, seq.next)
+	})
+	if err != nil {
+		return err
+	}
+
+	if released {
+		seq.leased = seq.next
+	}
+	return nil
+}
+
+// IDGen use the sequence as the id generator of a list, the ids are 8 bytes big-endian numbers.
+// The numbers are leased outside of the transaction of the list, so a failed transaction
+// will leave a gap in the ids.
+func (seq *Sequence) IDGen() IDGen {
+	return func(kvstore.Txn, interface{}) ([]byte, error) {
+		n, err := seq.Next()
+		if err != nil {
+			return nil, err
+		}
+		return idgen.Sequence(n), nil
+	}
+}
+
+func (seq *Sequence) counter(txn kvstore.Txn) (uint64, error) {
+	b, err := txn.Get(seq.bucket.Prefix(nil))
+	if err == ErrKeyNotFound {
+		return 1, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (seq *Sequence) setCounter(txn kvstore.Txn, n uint64) error {
+	return txn.Set(seq.bucket.Prefix(nil), idgen.Sequence(n))
+}
@@ -0,0 +1,141 @@
+package storer_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/badger"
+)
+
+func TestSequence(t *testing.T) {
+	name := kit.RandString(10)
+	seq := store.SequenceWithBandwidth(name, 3)
+
+	for i := uint64(1); i <= 5; i++ {
+		n, err := seq.Next()
+		kit.E(err)
+		assert.Equal(t, i, n)
+	}
+
+	// simulate a restart, the rest of the lease is skipped
+	n, err := store.SequenceWithBandwidth(name, 3).Next()
+	kit.E(err)
+	assert.Equal(t, uint64(7), n)
+
+	// the other sequence has leased after seq, nothing to release
+	kit.E(seq.Release())
+	n, err = seq.Next()
+	kit.E(err)
+	assert.Equal(t, uint64(6), n)
+
+	other := store.Sequence(name)
+	n, err = other.Next()
+	kit.E(err)
+	assert.Equal(t, uint64(10), n)
+
+	kit.E(other.Release())
+	n, err = store.Sequence(name).Next()
+	kit.E(err)
+	assert.Equal(t, uint64(11), n)
+}
+
+func TestSequenceConcurrent(t *testing.T) {
+	seq := store.SequenceWithBandwidth(kit.RandString(10), 7)
+
+	lock := sync.Mutex{}
+	nums := map[uint64]bool{}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				n, err := seq.Next()
+				kit.E(err)
+				lock.Lock()
+				nums[n] = true
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, nums, 500)
+}
+
+func TestSequenceRace(t *testing.T) {
+	name := kit.RandString(10)
+	seqs := []*storer.Sequence{store.SequenceWithBandwidth(name, 1), store.SequenceWithBandwidth(name, 1)}
+
+	lock := sync.Mutex{}
+	nums := map[uint64]int{}
+	conflicts := 0
+
+	wg := sync.WaitGroup{}
+	for _, seq := range seqs {
+		wg.Add(1)
+		go func(seq *storer.Sequence) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				n, err := seq.Next()
+				lock.Lock()
+				if err == nil {
+					nums[n]++
+				} else {
+					conflicts++
+				}
+				lock.Unlock()
+			}
+		}(seq)
+	}
+	wg.Wait()
+
+	// the numbers of a failed lease are never handed out
+	for n, c := range nums {
+		assert.Equal(t, 1, c, n)
+	}
+	assert.Len(t, nums, 400-conflicts)
+}
+
+func TestSequenceIDGen(t *testing.T) {
+	seq := store.SequenceWithBandwidth(kit.RandString(10), 0)
+	invoices := store.ListWithName(kit.RandString(10), &Event{}).SetIDGen(seq.IDGen())
+
+	id, err := invoices.Add(&Event{1})
+	kit.E(err)
+	assert.Equal(t, "0000000000000001", id)
+
+	id, err = invoices.Add(&Event{2})
+	kit.E(err)
+	assert.Equal(t, "0000000000000002", id)
+}
+
+func TestSequenceErr(t *testing.T) {
+	testErr := errors.New("err")
+	db := &TestStore{badger: badger.New("")}
+	store := storer.NewWithDB("", db)
+	seq := store.Sequence(kit.RandString(10))
+	list := store.ListWithName(kit.RandString(10), &Event{}).SetIDGen(seq.IDGen())
+
+	db.getQueue = []interface{}{[]interface{}{[]byte{}, testErr}}
+	_, err := list.Add(&Event{})
+	assert.Equal(t, testErr, err)
+
+	db.setQueue = []interface{}{testErr}
+	_, err = seq.Next()
+	assert.Equal(t, testErr, err)
+
+	_, err = seq.Next()
+	kit.E(err)
+
+	db.getQueue = []interface{}{[]interface{}{[]byte{}, testErr}}
+	assert.Equal(t, testErr, seq.Release())
+
+	db.setQueue = []interface{}{testErr}
+	assert.Equal(t, testErr, seq.Release())
+}
@@ -3,6 +3,7 @@ package storer
 import (
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ysmood/kit/pkg/utils"
 	"github.com/ysmood/storer/pkg/bucket"
@@ -30,52 +31,89 @@ type Store struct {
 	db Database
 
 	bucketCache *sync.Map
+
+	// tolerated the cache of the tolerant mode checks
+	tolerated *sync.Map
+
+	// expirers the functions to remove the expired items of the lists, the key is the prefix of the list
+	expirers    *sync.Map
+	janitorLock sync.Mutex
+	stopJanitor chan struct{}
+	janitorDone chan struct{}
 }
 
-// NewWithDB use your custom backend as the database
+// NewWithDB use your custom backend as the database.
+// If the backend doesn't support TTL natively, the janitor will be started with one minute interval.
 func NewWithDB(name string, db Database) *Store {
-	return &Store{
+	store := &Store{
 		name:        name,
 		db:          db,
 		bucketCache: &sync.Map{},
+		tolerated:   &sync.Map{},
+		expirers:    &sync.Map{},
+	}
+
+	native := false
+	_ = db.Do(false, func(txn kvstore.Txn) error {
+		native = nativeTTL(txn)
+		return nil
+	})
+	if !native {
+		store.Janitor(time.Minute)
 	}
+	return store
 }
 
 // Close close database
 func (store *Store) Close() error {
+	store.Janitor(0)
 	return store.db.Close()
 }
 
-// MapWithName ...
+// MapWithName the type history of the item will be registered in the database, it will panic with
+// IncompatibleSchemaError if the type of a non-empty collection is changed without Migratable
 func (store *Store) MapWithName(name string, item interface{}) *Map {
 	typeID := typee.GenTypeID(item)
 
-	return &Map{
+	m := &Map{
 		name:   name,
 		store:  store,
 		typeID: typeID,
 		bucket: store.bucket(typeID.Anchor, name),
 	}
+	utils.E(store.register(m))
+	return m
 }
 
 // ListWithName ...
 func (store *Store) ListWithName(name string, item interface{}) *List {
-	return &List{
+	list := &List{
 		dict:    store.MapWithName(name, item),
 		indexes: map[string]*Index{},
+		genID:   IDGenRandom,
 	}
+	list.dict.expiryKind = expiryList
+	store.expirers.Store(string(list.dict.bucket.Prefix(nil)), expirer(list.expire))
+	return list
 }
 
 // The prefix of the created bucket will be like "mydb:list:users"
 func (store *Store) bucket(names ...string) *bucket.Bucket {
-	name := strings.Join(append([]string{store.name}, names...), ":")
+	b, err := store.newBucket(names...)
+	utils.E(err)
+	return b
+}
 
+func (store *Store) newBucket(names ...string) (*bucket.Bucket, error) {
 	var b *bucket.Bucket
-	utils.E(store.Update(func(txn kvstore.Txn) error {
+	err := store.Update(func(txn kvstore.Txn) error {
 		var err error
-		b, err = bucket.New(txn, []byte(name))
+		b, err = bucket.New(txn, []byte(store.bucketName(names...)))
 		return err
-	}))
+	})
+	return b, err
+}
 
-	return b
+func (store *Store) bucketName(names ...string) string {
+	return strings.Join(append([]string{store.name}, names...), ":")
 }
@@ -0,0 +1,256 @@
+package storer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/ysmood/byframe"
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// When the backend doesn't support TTL natively, an expiry index is used to track the expiry, each
+// collection has its own index named "collectionName:expiry". The format of the key of the index is "bucket expireAt key", the expireAt is a big-endian uint64
+// so that the janitor can iterate the index by time. The value is the kind of the owner.
+type expiryKind byte
+
+const (
+	expiryMap expiryKind = iota
+	expiryList
+)
+
+// the number of expired items to remove in a single transaction
+const sweepBatch = 100
+
+// expirer removes an expired item and everything related to it
+type expirer func(txn kvstore.Txn, id []byte) error
+
+func expireAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+func nativeTTL(txn kvstore.Txn) bool {
+	_, ok := txn.(kvstore.TTLTxn)
+	return ok
+}
+
+// set the key with the expireAt, use native TTL if the backend supports it
+func (store *Store) set(txn kvstore.Txn, key, value []byte, expireAt int64) error {
+	if expireAt != 0 {
+		if t, ok := txn.(kvstore.TTLTxn); ok {
+			return t.SetWithTTL(key, value, time.Until(time.Unix(0, expireAt)))
+		}
+	}
+	return txn.Set(key, value)
+}
+
+// track the expiry of the key if the backend doesn't support TTL natively
+func (dict *Map) track(txn kvstore.Txn, key []byte, at int64) error {
+	if at == 0 || nativeTTL(txn) {
+		return nil
+	}
+
+	b, err := dict.expiryBucket()
+	if err != nil {
+		return err
+	}
+
+	k := make([]byte, 8, 8+len(key))
+	binary.BigEndian.PutUint64(k, uint64(at))
+
+	return txn.Set(b.Prefix(append(k, key...)), []byte{byte(dict.expiryKind)})
+}
+
+// expiryBucket each collection has its own expiry index, so that the index is always updated with the items
+func (dict *Map) expiryBucket() (*bucket.Bucket, error) {
+	dict.expiryLock.Lock()
+	defer dict.expiryLock.Unlock()
+
+	if dict.expiry != nil {
+		return dict.expiry, nil
+	}
+
+	b, err := dict.store.newBucket(dict.typeID.Anchor, dict.name, "expiry")
+	if err != nil {
+		return nil, err
+	}
+
+	dict.expiry = b
+	return b, nil
+}
+
+// expiryBuckets get the existing expiry indexes of the collections, and the shared expiry index used by
+// the old versions, nothing will be created
+func (store *Store) expiryBuckets() ([]*bucket.Bucket, error) {
+	cols, err := store.Collections()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{store.name + ":expiry"}
+	for _, col := range cols {
+		names = append(names, col.Name+":expiry")
+	}
+
+	list := []*bucket.Bucket{}
+	err = store.View(func(txn Txn) error {
+		for _, name := range names {
+			b, err := bucket.Lookup(txn, []byte(name))
+			if err == ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			list = append(list, b)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// Janitor start a background goroutine to remove expired items periodically.
+// It's only useful when the backend doesn't support TTL natively, NewWithDB starts it for such backends.
+// If the interval is not positive the janitor will stop.
+func (store *Store) Janitor(interval time.Duration) {
+	store.janitorLock.Lock()
+	defer store.janitorLock.Unlock()
+
+	if store.stopJanitor != nil {
+		close(store.stopJanitor)
+
+		// wait for the running sweep, so that the db won't be closed during it
+		<-store.janitorDone
+		store.stopJanitor = nil
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	store.stopJanitor = stop
+	store.janitorDone = done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_ = store.Sweep()
+			}
+		}
+	}()
+}
+
+// Sweep remove the expired items and their indexes. The janitor calls it periodically.
+// The items of a list will only be removed after the list is created in the current process,
+// because the indexes of a list are only known at runtime.
+func (store *Store) Sweep() error {
+	list, err := store.expiryBuckets()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range list {
+		from := b.Prefix(nil)
+		for from != nil {
+			err := store.Update(func(txn Txn) error {
+				var err error
+				from, err = store.sweep(txn, b, from)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sweep a batch of expired items, returns where the next sweep should begin,
+// nil means there's nothing left to sweep
+func (store *Store) sweep(txn kvstore.Txn, b *bucket.Bucket, from []byte) ([]byte, error) {
+	now := make([]byte, 8)
+	binary.BigEndian.PutUint64(now, uint64(time.Now().UnixNano()))
+
+	keys := [][]byte{}
+	var next []byte
+	err := txn.Do(false, from, func(key []byte) error {
+		if !b.Valid(key) || bytes.Compare(key[b.Len():b.Len()+8], now) > 0 {
+			return ErrStop
+		}
+		if len(keys) == sweepBatch {
+			next = append([]byte{}, key...)
+			return ErrStop
+		}
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		err = store.sweepKey(txn, key, b.Len())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return next, nil
+}
+
+func (store *Store) sweepKey(txn kvstore.Txn, key []byte, l int) error {
+	at := int64(binary.BigEndian.Uint64(key[l : l+8]))
+	itemKey := key[l+8:]
+
+	kind, err := txn.Get(key)
+	if err != nil {
+		return err
+	}
+
+	raw, err := txn.Get(itemKey)
+	if err == nil {
+		r, err := decodeRecord(raw)
+		if err != nil {
+			return err
+		}
+
+		// the item is updated after the expiry is tracked
+		if r.expireAt == at {
+			_, hLen, _ := byframe.DecodeHeader(itemKey)
+
+			fn := expirer(func(txn kvstore.Txn, id []byte) error {
+				return txn.Delete(itemKey)
+			})
+			if expiryKind(kind[0]) == expiryList {
+				v, has := store.expirers.Load(string(itemKey[:hLen]))
+				if !has {
+					// keep the tracking until the list is created
+					return nil
+				}
+				fn = v.(expirer)
+			}
+
+			err = fn(txn, itemKey[hLen:])
+			if err != nil {
+				return err
+			}
+		}
+	} else if err != ErrKeyNotFound {
+		return err
+	}
+
+	return txn.Delete(key)
+}
@@ -0,0 +1,149 @@
+package storer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/badger"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+func countKeys(db kvstore.Store) int {
+	n := 0
+	kit.E(db.Do(false, func(txn kvstore.Txn) error {
+		return txn.Do(false, nil, func(_ []byte) error {
+			n++
+			return nil
+		})
+	}))
+	return n
+}
+
+func TestMapTTL(t *testing.T) {
+	users := store.MapWithName(kit.RandString(10), &User{})
+
+	var u User
+
+	kit.E(users.SetWithTTL("a", &User{"a", 1}, time.Second))
+	kit.E(users.SetWithTTL("b", &User{"b", 1}, time.Second))
+	kit.E(users.Set("b", &User{"b", 2}))
+	kit.E(users.Get("a", &u))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	assert.Equal(t, storer.ErrKeyNotFound, users.Get("a", &u))
+	kit.E(users.Get("b", &u))
+	assert.Equal(t, 2, u.Level)
+}
+
+func TestListTTL(t *testing.T) {
+	users := store.ListWithName(kit.RandString(10), &User{})
+	index := users.Index("level", func(u *User) interface{} {
+		return u.Level
+	})
+
+	a, err := users.AddWithTTL(&User{"a", 1}, time.Second)
+	kit.E(err)
+	b, err := users.AddWithTTL(&User{"b", 2}, time.Second)
+	kit.E(err)
+	kit.E(users.Set(b, &User{"b", 3}))
+
+	var u User
+	kit.E(index.From(1).Find(&u))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	assert.Equal(t, storer.ErrKeyNotFound, users.Get(a, &u))
+	assert.Equal(t, storer.ErrNotFound, index.From(1).Find(&u))
+	kit.E(index.From(3).Find(&u))
+	assert.Equal(t, "b", u.Name)
+}
+
+func TestTTLWithoutNativeSupport(t *testing.T) {
+	db := &TestStore{badger: badger.New("")}
+	store := storer.NewWithDB("", db)
+	users := store.ListWithName(kit.RandString(10), &User{})
+	index := users.Index("level", func(u *User) interface{} {
+		return u.Level
+	})
+	dict := store.MapWithName(kit.RandString(10), &User{})
+
+	// create the type mapping and expiry buckets
+	_, err := users.AddWithTTL(&User{}, time.Nanosecond)
+	kit.E(err)
+	kit.E(dict.SetWithTTL("a", &User{}, time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	kit.E(store.Sweep())
+	count := countKeys(db)
+
+	_, err = users.AddWithTTL(&User{"a", 1}, 50*time.Millisecond)
+	kit.E(err)
+	id, err := users.AddWithTTL(&User{"b", 1}, 50*time.Millisecond)
+	kit.E(err)
+	kit.E(users.Set(id, &User{"b", 1}))
+	kit.E(dict.SetWithTTL("a", &User{"a", 1}, 50*time.Millisecond))
+
+	var list []User
+	kit.E(index.From(1).Find(&list))
+	assert.Len(t, list, 2)
+
+	time.Sleep(100 * time.Millisecond)
+
+	var u User
+	assert.Equal(t, storer.ErrKeyNotFound, dict.Get("a", &u))
+
+	list = nil
+	kit.E(index.From(1).Find(&list))
+	assert.Equal(t, []User{{"b", 1}}, list)
+
+	ids := 0
+	kit.E(users.View(func(txn *storer.ListTxn) error {
+		return txn.Each(func(_ []byte) error {
+			ids++
+			return nil
+		})
+	}))
+	assert.Equal(t, 1, ids)
+
+	kit.E(users.Del(id))
+	kit.E(store.Sweep())
+	assert.Equal(t, count, countKeys(db))
+}
+
+func TestSweepWithoutExpiry(t *testing.T) {
+	db := &TestStore{badger: badger.New("")}
+	store := storer.NewWithDB("", db)
+
+	// the sweep doesn't create the expiry bucket
+	kit.E(store.Sweep())
+	assert.Equal(t, 0, countKeys(db))
+	kit.E(store.Close())
+}
+
+func TestJanitor(t *testing.T) {
+	db := &TestStore{badger: badger.New("")}
+	store := storer.NewWithDB("", db)
+	users := store.ListWithName(kit.RandString(10), &User{})
+	_ = users.Index("level", func(u *User) interface{} {
+		return u.Level
+	})
+
+	// create the type mapping and expiry buckets
+	_, err := users.AddWithTTL(&User{}, time.Nanosecond)
+	kit.E(err)
+	time.Sleep(time.Millisecond)
+	kit.E(store.Sweep())
+	count := countKeys(db)
+
+	_, err = users.AddWithTTL(&User{"a", 1}, 10*time.Millisecond)
+	kit.E(err)
+
+	store.Janitor(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, count, countKeys(db))
+	kit.E(store.Close())
+}
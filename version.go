@@ -0,0 +1,116 @@
+package storer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ysmood/storer/pkg/typee"
+)
+
+// ErrConflict ...
+var ErrConflict = errors.New("[storer] version conflict")
+
+// ConflictError returned when the version of the item has moved.
+// errors.Is(err, ErrConflict) can be used to check it.
+type ConflictError struct {
+	// ID the id of the item
+	ID []byte
+	// Expected the version the caller expected
+	Expected uint64
+	// Actual the current version of the item, 0 means the item doesn't exist
+	Actual uint64
+}
+
+// Error ...
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("[storer] version conflict of %x, expected %d but got %d", e.ID, e.Expected, e.Actual)
+}
+
+// Is ...
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// GetByBytesWithVersion get item and its version from the map.
+// The version starts from 1 and increases each time the item is set.
+// The migrated item is returned without typee.ErrMigrated, the migration doesn't change the version.
+func (dictTxn *MapTxn) GetByBytesWithVersion(id []byte, item interface{}) (uint64, error) {
+	r, err := dictTxn.get(id, nil, item)
+	if err != nil && err != typee.ErrMigrated {
+		return 0, err
+	}
+	return r.revision, nil
+}
+
+// SetByBytesIfVersion set the item only if its current version is the version,
+// version 0 means the item must not exist. The expiry of the item is kept.
+func (dictTxn *MapTxn) SetByBytesIfVersion(id []byte, item interface{}, version uint64) error {
+	prev, err := dictTxn.check(id, version)
+	if err != nil {
+		return err
+	}
+	return dictTxn.set(id, item, prevExpireAt(prev), nextRevision(prev))
+}
+
+// DelByBytesIfVersion remove the item only if its current version is the version
+func (dictTxn *MapTxn) DelByBytesIfVersion(id []byte, version uint64) error {
+	_, err := dictTxn.check(id, version)
+	if err != nil {
+		return err
+	}
+	return dictTxn.DelByBytes(id)
+}
+
+// check if the current version of the item is the version
+func (dictTxn *MapTxn) check(id []byte, version uint64) (*record, error) {
+	prev, err := dictTxn.prev(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var actual uint64
+	if prev != nil {
+		actual = prev.revision
+	}
+
+	if actual != version {
+		return nil, &ConflictError{ID: id, Expected: version, Actual: actual}
+	}
+	return prev, nil
+}
+
+// the expiry of the record, 0 if the record doesn't exist
+func prevExpireAt(prev *record) int64 {
+	if prev == nil {
+		return 0
+	}
+	return prev.expireAt
+}
+
+// GetByBytesWithVersion get item and its version from the list
+func (listTxn *ListTxn) GetByBytesWithVersion(id []byte, item interface{}) (uint64, error) {
+	r, err := listTxn.get(id, nil, item)
+	if err != nil {
+		return 0, err
+	}
+	return r.revision, nil
+}
+
+// SetByBytesIfVersion update an existing item only if its current version is the version,
+// the expiry of the item is kept
+func (listTxn *ListTxn) SetByBytesIfVersion(id []byte, item interface{}, version uint64) error {
+	prev, err := listTxn.dictTxn.check(id, version)
+	if err != nil {
+		return err
+	}
+	return listTxn.set(id, item, prevExpireAt(prev), prev)
+}
+
+// DelByBytesIfVersion remove an item only if its current version is the version
+func (listTxn *ListTxn) DelByBytesIfVersion(id []byte, version uint64) error {
+	_, err := listTxn.dictTxn.check(id, version)
+	if err != nil {
+		return err
+	}
+	return listTxn.DelByBytes(id)
+}
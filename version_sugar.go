@@ -0,0 +1,125 @@
+package storer
+
+import (
+	"encoding/hex"
+)
+
+// GetWithVersion string version of MapTxn.GetByBytesWithVersion
+func (t *MapTxn) GetWithVersion(id string, item interface{}) (uint64, error) {
+	return t.GetByBytesWithVersion([]byte(id), item)
+}
+
+// SetIfVersion string version of MapTxn.SetByBytesIfVersion
+func (t *MapTxn) SetIfVersion(id string, item interface{}, version uint64) error {
+	return t.SetByBytesIfVersion([]byte(id), item, version)
+}
+
+// DelIfVersion string version of MapTxn.DelByBytesIfVersion
+func (t *MapTxn) DelIfVersion(id string, version uint64) error {
+	return t.DelByBytesIfVersion([]byte(id), version)
+}
+
+// GetWithVersion ...
+func (m *Map) GetWithVersion(id string, item interface{}) (version uint64, err error) {
+	err = m.store.View(func(txn Txn) error {
+		version, err = m.Txn(txn).GetWithVersion(id, item)
+		return err
+	})
+	return
+}
+
+// SetIfVersion ...
+func (m *Map) SetIfVersion(id string, item interface{}, version uint64) error {
+	return m.store.Update(func(txn Txn) error {
+		return m.Txn(txn).SetIfVersion(id, item, version)
+	})
+}
+
+// DelIfVersion ...
+func (m *Map) DelIfVersion(id string, version uint64) error {
+	return m.store.Update(func(txn Txn) error {
+		return m.Txn(txn).DelIfVersion(id, version)
+	})
+}
+
+// CompareAndSwap get the item, let fn modify it, then set it back only if no one else
+// has changed the item in the meantime, otherwise a ConflictError will be returned.
+// The fn runs outside of any transaction so it can take as long as it needs.
+func (m *Map) CompareAndSwap(id string, item interface{}, fn func() error) error {
+	version, err := m.GetWithVersion(id, item)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return m.SetIfVersion(id, item, version)
+}
+
+// GetWithVersion string version of ListTxn.GetByBytesWithVersion
+func (listTxn *ListTxn) GetWithVersion(id string, item interface{}) (uint64, error) {
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return 0, err
+	}
+	return listTxn.GetByBytesWithVersion(b, item)
+}
+
+// SetIfVersion string version of ListTxn.SetByBytesIfVersion
+func (listTxn *ListTxn) SetIfVersion(id string, item interface{}, version uint64) error {
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return err
+	}
+	return listTxn.SetByBytesIfVersion(b, item, version)
+}
+
+// DelIfVersion string version of ListTxn.DelByBytesIfVersion
+func (listTxn *ListTxn) DelIfVersion(id string, version uint64) error {
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return err
+	}
+	return listTxn.DelByBytesIfVersion(b, version)
+}
+
+// GetWithVersion auto transaction version of ListTxn.GetWithVersion
+func (list *List) GetWithVersion(id string, item interface{}) (version uint64, err error) {
+	err = list.View(func(txn *ListTxn) error {
+		version, err = txn.GetWithVersion(id, item)
+		return err
+	})
+	return
+}
+
+// SetIfVersion auto transaction version of ListTxn.SetIfVersion
+func (list *List) SetIfVersion(id string, item interface{}, version uint64) error {
+	return list.Update(func(txn *ListTxn) error {
+		return txn.SetIfVersion(id, item, version)
+	})
+}
+
+// DelIfVersion auto transaction version of ListTxn.DelIfVersion
+func (list *List) DelIfVersion(id string, version uint64) error {
+	return list.Update(func(txn *ListTxn) error {
+		return txn.DelIfVersion(id, version)
+	})
+}
+
+// CompareAndSwap the same as Map.CompareAndSwap
+func (list *List) CompareAndSwap(id string, item interface{}, fn func() error) error {
+	version, err := list.GetWithVersion(id, item)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return list.SetIfVersion(id, item, version)
+}
@@ -0,0 +1,143 @@
+package storer_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/badger"
+)
+
+func TestMapVersion(t *testing.T) {
+	users := store.MapWithName(kit.RandString(10), &User{})
+
+	var u User
+
+	kit.E(users.SetIfVersion("a", &User{"a", 1}, 0))
+	err := users.SetIfVersion("a", &User{"a", 1}, 0)
+	assert.True(t, errors.Is(err, storer.ErrConflict))
+	assert.Equal(t, &storer.ConflictError{ID: []byte("a"), Expected: 0, Actual: 1}, err)
+	assert.EqualError(t, err, "[storer] version conflict of 61, expected 0 but got 1")
+
+	kit.E(users.Set("a", &User{"a", 2}))
+
+	v, err := users.GetWithVersion("a", &u)
+	kit.E(err)
+	assert.Equal(t, uint64(2), v)
+	assert.Equal(t, 2, u.Level)
+
+	err = users.DelIfVersion("a", 1)
+	assert.True(t, errors.Is(err, storer.ErrConflict))
+
+	kit.E(users.DelIfVersion("a", 2))
+	_, err = users.GetWithVersion("a", &u)
+	assert.Equal(t, storer.ErrKeyNotFound, err)
+}
+
+func TestListVersion(t *testing.T) {
+	users := store.ListWithName(kit.RandString(10), &User{})
+	index := users.Index("level", func(u *User) interface{} {
+		return u.Level
+	})
+
+	id, err := users.Add(&User{"a", 1})
+	kit.E(err)
+
+	var u User
+	v, err := users.GetWithVersion(id, &u)
+	kit.E(err)
+	assert.Equal(t, uint64(1), v)
+
+	kit.E(users.SetIfVersion(id, &User{"a", 2}, 1))
+	err = users.SetIfVersion(id, &User{"a", 3}, 1)
+	assert.True(t, errors.Is(err, storer.ErrConflict))
+
+	kit.E(index.From(2).Find(&u))
+	assert.Equal(t, storer.ErrNotFound, index.From(1).Find(&u))
+
+	assert.True(t, errors.Is(users.DelIfVersion(id, 1), storer.ErrConflict))
+	kit.E(users.DelIfVersion(id, 2))
+	assert.Equal(t, storer.ErrNotFound, index.From(2).Find(&u))
+
+	assert.EqualError(t, users.SetIfVersion(".", &u, 0), "encoding/hex: invalid byte: U+002E '.'")
+	assert.EqualError(t, users.DelIfVersion(".", 0), "encoding/hex: invalid byte: U+002E '.'")
+	_, err = users.GetWithVersion(".", &u)
+	assert.EqualError(t, err, "encoding/hex: invalid byte: U+002E '.'")
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	users := store.ListWithName(kit.RandString(10), &User{})
+	id, err := users.Add(&User{"a", 1})
+	kit.E(err)
+
+	var u User
+	kit.E(users.CompareAndSwap(id, &u, func() error {
+		u.Level++
+		return nil
+	}))
+
+	err = users.CompareAndSwap(id, &u, func() error {
+		// another service changes the item in the meantime
+		return users.Set(id, &User{"b", 10})
+	})
+	assert.True(t, errors.Is(err, storer.ErrConflict))
+
+	kit.E(users.Get(id, &u))
+	assert.Equal(t, User{"b", 10}, u)
+
+	testErr := errors.New("err")
+	assert.Equal(t, testErr, users.CompareAndSwap(id, &u, func() error {
+		return testErr
+	}))
+
+	dict := store.MapWithName(kit.RandString(10), &User{})
+	kit.E(dict.Set("a", &User{"a", 1}))
+	kit.E(dict.CompareAndSwap("a", &u, func() error {
+		u.Level = 5
+		return nil
+	}))
+	kit.E(dict.Get("a", &u))
+	assert.Equal(t, 5, u.Level)
+	assert.Equal(t, storer.ErrKeyNotFound, dict.CompareAndSwap("b", &u, nil))
+	assert.Equal(t, testErr, dict.CompareAndSwap("a", &u, func() error {
+		return testErr
+	}))
+}
+
+func TestVersionKeepTTL(t *testing.T) {
+	db := &TestStore{badger: badger.New("")}
+	store := storer.NewWithDB("", db)
+	users := store.ListWithName(kit.RandString(10), &User{})
+	index := users.Index("level", func(u *User) interface{} {
+		return u.Level
+	})
+	dict := store.MapWithName(kit.RandString(10), &User{})
+
+	// create the type mapping and expiry buckets
+	_, err := users.AddWithTTL(&User{}, time.Nanosecond)
+	kit.E(err)
+	kit.E(dict.SetWithTTL("a", &User{}, time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	kit.E(store.Sweep())
+	count := countKeys(db)
+
+	id, err := users.AddWithTTL(&User{"a", 1}, 50*time.Millisecond)
+	kit.E(err)
+	kit.E(users.SetIfVersion(id, &User{"a", 2}, 1))
+	kit.E(dict.SetWithTTL("a", &User{"a", 1}, 50*time.Millisecond))
+	kit.E(dict.SetIfVersion("a", &User{"a", 2}, 1))
+
+	time.Sleep(100 * time.Millisecond)
+
+	var u User
+	assert.Equal(t, storer.ErrKeyNotFound, users.Get(id, &u))
+	assert.Equal(t, storer.ErrNotFound, index.From(2).Find(&u))
+	assert.Equal(t, storer.ErrKeyNotFound, dict.Get("a", &u))
+
+	// nothing is left in the expiry index
+	kit.E(store.Sweep())
+	assert.Equal(t, count, countKeys(db))
+}
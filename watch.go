@@ -0,0 +1,100 @@
+package storer
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ysmood/storer/pkg/bucket"
+	"github.com/ysmood/storer/pkg/kvstore"
+)
+
+// ErrNoNotifier the database doesn't implement kvstore.Notifier
+var ErrNoNotifier = errors.New("[storer] the database can't notify the changes")
+
+// Watch call the fn with the names of the buckets of the store changed by each committed update transaction,
+// such as "storeName:typeAnchor:collectionName" for a collection, and the same name with the suffix
+// ":index:indexName" for its index, the internal buckets of the store are excluded. If the database is shared by multiple processes, such as Postgres with
+// the Channel set, the changes of all the processes are included. The names are nil if any bucket may have
+// changed, the caches should be dropped then. ErrNoNotifier will be returned if the database doesn't
+// implement kvstore.Notifier.
+func (store *Store) Watch(fn func(names []string)) (stop func() error, err error) {
+	n, ok := store.db.(kvstore.Notifier)
+	if !ok {
+		return nil, ErrNoNotifier
+	}
+
+	w := &watcher{store: store, names: map[string]string{}}
+
+	return n.Notify(func(prefixes [][]byte) {
+		if prefixes == nil {
+			fn(nil)
+			return
+		}
+
+		names := w.resolve(prefixes)
+		if len(names) > 0 {
+			fn(names)
+		}
+	})
+}
+
+// the buckets of the store itself, they aren't the data of any collection
+var internalBuckets = map[string]struct{}{"schema": {}, "collections": {}, "fields": {}, "expiry": {}}
+
+// watcher map the bucket prefixes to the names
+type watcher struct {
+	store *Store
+
+	lock sync.Mutex
+
+	// names the names of the bucket prefixes
+	names map[string]string
+}
+
+func (w *watcher) resolve(prefixes [][]byte) []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, prefix := range prefixes {
+		if _, has := w.names[string(prefix)]; !has {
+			// the bucket may be created after the last load
+			w.load()
+			break
+		}
+	}
+
+	names := []string{}
+	own := w.store.bucketName("")
+	for _, prefix := range prefixes {
+		name, has := w.names[string(prefix)]
+		if !has || !strings.HasPrefix(name, own) {
+			continue
+		}
+		if _, internal := internalBuckets[strings.TrimPrefix(name, own)]; !internal {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// load all the names of the buckets, the dropped buckets won't be resolved
+func (w *watcher) load() {
+	_ = w.store.View(func(txn Txn) error {
+		names, err := bucket.Names(txn)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			b, err := bucket.Lookup(txn, name)
+			if err != nil {
+				return err
+			}
+			w.names[string(b.Prefix(nil))] = string(name)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,60 @@
+package storer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysmood/kit"
+	"github.com/ysmood/storer"
+	"github.com/ysmood/storer/pkg/memory"
+)
+
+type Sensor struct {
+	Name string
+}
+
+func TestWatch(t *testing.T) {
+	db := memory.New()
+	store := storer.NewWithDB("", db)
+	sensors := store.ListWithName("sensors", &Sensor{})
+	sensors.Index("name", func(s *Sensor) interface{} {
+		return s.Name
+	})
+
+	changes := [][]string{}
+	stop, err := store.Watch(func(names []string) {
+		changes = append(changes, names)
+	})
+	kit.E(err)
+
+	_, err = sensors.Add(&Sensor{"a"})
+	kit.E(err)
+
+	// the schema of the new collection is recorded in the internal buckets
+	kit.E(store.MapWithName("logs", &Sensor{}).Set("a", &Sensor{"a"}))
+
+	// the other stores sharing the same database are ignored
+	_, err = storer.NewWithDB("other", db).ListWithName("sensors", &Sensor{}).Add(&Sensor{"a"})
+	kit.E(err)
+
+	kit.E(stop())
+	count := len(changes)
+	_, _ = sensors.Add(&Sensor{"b"})
+	assert.Len(t, changes, count)
+
+	assert.Contains(t, changes, []string{
+		":storer_test.Sensor:sensors",
+		":storer_test.Sensor:sensors:index:name",
+		":storer_test.Sensor:sensors:rindex:name",
+	})
+	assert.Contains(t, changes, []string{":storer_test.Sensor:logs"})
+	for _, names := range changes {
+		for _, name := range names {
+			assert.NotContains(t, name, "other:")
+			assert.NotContains(t, []string{":schema", ":collections", ":fields"}, name)
+		}
+	}
+
+	_, err = storer.New("").Watch(func([]string) {})
+	assert.Equal(t, storer.ErrNoNotifier, err)
+}